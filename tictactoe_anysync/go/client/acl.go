@@ -0,0 +1,291 @@
+package client
+
+import (
+    "context"
+    "crypto/ed25519"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace/acl/aclclient"
+    "github.com/anyproto/any-sync/commonspace/object/acl/aclrecordproto"
+    "github.com/anyproto/any-sync/commonspace/object/acl/list"
+    "github.com/anyproto/any-sync/consensus/consensusproto"
+    "github.com/anyproto/any-sync/util/crypto"
+)
+
+// Players join a space through its ACL: the owner publishes an invite record
+// and hands out the invite's private key; a joiner proves possession of it,
+// which adds them as a writer and gives them the read key. No shared
+// mnemonic is needed, each player keeps their own identity.
+//
+// Players who only know the space id file a join request, which the owner
+// approves with a permission level or declines. any-sync signs requests with
+// the key of a request-to-join invite, so every space gets one whose key is
+// derived from the space id: knowing the id lets you ask, never join. Owners
+// and admins publish it when they open the space. Join requests and ACL
+// changes are announced from the syncacl update hook.
+
+// Invite is what a player shares to let someone else join a space
+type Invite struct {
+    SpaceId   string `json:"spaceId"`
+    InviteKey string `json:"inviteKey"` // base64url of the marshaled invite private key
+}
+
+// JoinRequest is a pending request to join a space, as delivered in the
+// join_request event
+type JoinRequest struct {
+    Type      string `json:"type"` // always "join_request"
+    SpaceId   string `json:"spaceId"`
+    Identity  string `json:"identity"`
+    RecordId  string `json:"recordId"`
+    Timestamp int64  `json:"timestamp"`
+}
+
+const joinRequestEvent = "join_request"
+
+// ParsePermissions maps "reader", "writer" or "admin" to ACL permissions
+func ParsePermissions(s string) (list.AclPermissions, error) {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+    case "reader":
+        return list.AclPermissionsReader, nil
+    case "writer":
+        return list.AclPermissionsWriter, nil
+    case "admin":
+        return list.AclPermissionsAdmin, nil
+    }
+    return list.AclPermissionsNone, fmt.Errorf("%w: permission %q (want reader, writer or admin)", ErrInvalidArgument, s)
+}
+
+// Encode renders the invite as the JSON payload passed to JoinWithInvite
+func (inv Invite) Encode() string {
+    b, _ := json.Marshal(inv)
+    return string(b)
+}
+
+// ParseInvite decodes an invite payload
+func ParseInvite(payload string) (Invite, error) {
+    var inv Invite
+    if err := json.Unmarshal([]byte(strings.TrimSpace(payload)), &inv); err != nil { return inv, fmt.Errorf("%w: invite: %v", ErrInvalidArgument, err) }
+    if inv.SpaceId == "" || inv.InviteKey == "" { return inv, fmt.Errorf("%w: invite needs spaceId and inviteKey", ErrInvalidArgument) }
+    return inv, nil
+}
+
+func (inv Invite) privKey() (crypto.PrivKey, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(inv.InviteKey)
+    if err != nil { return nil, fmt.Errorf("%w: invite key: %v", ErrInvalidArgument, err) }
+    key, err := crypto.UnmarshalEd25519PrivateKeyProto(raw)
+    if err != nil { return nil, fmt.Errorf("%w: invite key: %v", ErrInvalidArgument, err) }
+    return key, nil
+}
+
+// aclSpace returns an open non-demo space for ACL operations. Callers hold
+// lifecycleMu for reading.
+func (c *Client) aclSpace(spaceId string) (*openSpace, error) {
+    if !c.started { return nil, ErrNotStarted }
+    s, err := c.getSpace(spaceId)
+    if err != nil { return nil, err }
+    if s.demo() { return nil, fmt.Errorf("%w: demo space %s has no ACL", ErrInvalidArgument, spaceId) }
+    return s, nil
+}
+
+// CreateInvite publishes an invite record in the space ACL and returns the
+// invite. Whoever holds it joins as a writer without further approval; only
+// the owner and admins may invite.
+func (c *Client) CreateInvite(ctx context.Context, spaceId string) (Invite, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.aclSpace(spaceId)
+    if err != nil { return Invite{}, err }
+    acl := s.space.AclClient()
+    // GenerateInvite(shouldRevokeAll, isRequestToJoin, permissions)
+    res, err := acl.GenerateInvite(false, false, list.AclPermissionsWriter)
+    if err != nil { return Invite{}, fmt.Errorf("generate invite: %w", err) }
+    if err := acl.AddRecord(ctx, res.InviteRec); err != nil { return Invite{}, fmt.Errorf("publish invite: %w", err) }
+    raw, err := res.InviteKey.Marshall()
+    if err != nil { return Invite{}, err }
+    return Invite{SpaceId: spaceId, InviteKey: base64.RawURLEncoding.EncodeToString(raw)}, nil
+}
+
+// JoinWithInvite joins the space through its ACL with the invite and opens it
+func (c *Client) JoinWithInvite(ctx context.Context, inv Invite) error {
+    key, err := inv.privKey()
+    if err != nil { return err }
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    if !c.started { return ErrNotStarted }
+    if c.demoMode { return fmt.Errorf("%w: invites need the any-sync network", ErrInvalidArgument) }
+    if _, err := c.getSpace(inv.SpaceId); err == nil { return nil }
+    joining := anyapp.MustComponent[aclclient.AclJoiningClient](c.app)
+    if _, err := joining.InviteJoin(ctx, inv.SpaceId, list.InviteJoinPayload{InviteKey: key, Permissions: list.AclPermissionsWriter}); err != nil {
+        return fmt.Errorf("invite join %s: %w", inv.SpaceId, err)
+    }
+    _, err = c.openSpace(ctx, inv.SpaceId)
+    return err
+}
+
+// RequestJoin files a join request for a space known only by its id. The
+// owner gets a join_request event; the space can be joined (JoinSpace) once
+// they approve.
+func (c *Client) RequestJoin(ctx context.Context, spaceId string) error {
+    if spaceId == "" { return fmt.Errorf("%w: empty space id", ErrInvalidArgument) }
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    if !c.started { return ErrNotStarted }
+    if c.demoMode { return fmt.Errorf("%w: join requests need the any-sync network", ErrInvalidArgument) }
+    joining := anyapp.MustComponent[aclclient.AclJoiningClient](c.app)
+    if _, err := joining.RequestJoin(ctx, spaceId, list.RequestJoinPayload{InviteKey: requestInviteKey(spaceId)}); err != nil {
+        return fmt.Errorf("request join %s: %w", spaceId, err)
+    }
+    return nil
+}
+
+// requestInviteKey is the key of the space's request-to-join invite; anyone
+// who knows the space id can derive it
+func requestInviteKey(spaceId string) crypto.PrivKey {
+    seed := sha256.Sum256([]byte("tictactoe join request\x00" + spaceId))
+    return crypto.NewEd25519PrivKey(ed25519.NewKeyFromSeed(seed[:]))
+}
+
+// requestInviteState reports whether we may manage the accounts of the space
+// and whether its request-to-join invite is in the ACL
+func (s *openSpace) requestInviteState() (canManage, published bool) {
+    pub := requestInviteKey(s.id).GetPublic()
+    acl := s.space.Acl()
+    acl.RLock()
+    defer acl.RUnlock()
+    st := acl.AclState()
+    if !st.Permissions(st.AccountKey().GetPublic()).CanManageAccounts() { return false, false }
+    for _, inv := range st.Invites(aclrecordproto.AclInviteType_RequestToJoin) {
+        if inv.Key.Equals(pub) { return true, true }
+    }
+    return true, false
+}
+
+// publishRequestInvite adds the request-to-join invite of the space to its
+// ACL. aclclient only generates random invite keys, so the record is built
+// here the way list.AclRecordBuilder builds invites.
+func (s *openSpace) publishRequestInvite(ctx context.Context) error {
+    pub, err := requestInviteKey(s.id).GetPublic().Marshall()
+    if err != nil { return err }
+    data, err := (&aclrecordproto.AclData{AclContent: []*aclrecordproto.AclContentValue{{
+        Value: &aclrecordproto.AclContentValue_Invite{Invite: &aclrecordproto.AclAccountInvite{InviteKey: pub, InviteType: aclrecordproto.AclInviteType_RequestToJoin}},
+    }}}).Marshal()
+    if err != nil { return err }
+    acl := s.space.Acl()
+    acl.RLock()
+    key, prevId := acl.AclState().AccountKey(), acl.Head().Id
+    acl.RUnlock()
+    identity, err := key.GetPublic().Marshall()
+    if err != nil { return err }
+    payload, err := (&aclrecordproto.AclRecord{PrevId: prevId, Identity: identity, Data: data, Timestamp: time.Now().Unix()}).Marshal()
+    if err != nil { return err }
+    sig, err := key.Sign(payload)
+    if err != nil { return err }
+    return s.space.AclClient().AddRecord(ctx, &consensusproto.RawRecord{Payload: payload, Signature: sig})
+}
+
+// ensureRequestInvite publishes the request-to-join invite when we manage
+// the space and it is missing. A failure (the space not on the nodes yet) is
+// retried on the next ACL update.
+func (s *openSpace) ensureRequestInvite(ctx context.Context) {
+    if canManage, published := s.requestInviteState(); !canManage || published { return }
+    if err := s.publishRequestInvite(ctx); err != nil { log.Printf("request invite %s: %v", s.id, err) }
+}
+
+// joinRequest finds the pending request of identity
+func joinRequest(s *openSpace, identity string) (list.RequestRecord, error) {
+    recs, err := s.joinRecords()
+    if err != nil { return list.RequestRecord{}, err }
+    for _, r := range recs {
+        if r.RequestIdentity.Account() == identity { return r, nil }
+    }
+    return list.RequestRecord{}, fmt.Errorf("%w: no join request from %s", ErrInvalidArgument, identity)
+}
+
+// ApproveJoin accepts the pending request of identity with the given
+// permissions ("reader", "writer" or "admin"); the read key is shared with it
+func (c *Client) ApproveJoin(ctx context.Context, spaceId, identity, permission string) error {
+    perms, err := ParsePermissions(permission)
+    if err != nil { return err }
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.aclSpace(spaceId)
+    if err != nil { return err }
+    req, err := joinRequest(s, identity)
+    if err != nil { return err }
+    err = s.space.AclClient().AcceptRequest(ctx, list.RequestAcceptPayload{RequestRecordId: req.RecordId, Permissions: perms})
+    if err != nil { return fmt.Errorf("approve %s: %w", identity, err) }
+    return nil
+}
+
+// DeclineJoin declines the pending request of identity
+func (c *Client) DeclineJoin(ctx context.Context, spaceId, identity string) error {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.aclSpace(spaceId)
+    if err != nil { return err }
+    req, err := joinRequest(s, identity)
+    if err != nil { return err }
+    if err := s.space.AclClient().DeclineRequest(ctx, req.RequestIdentity); err != nil { return fmt.Errorf("decline %s: %w", identity, err) }
+    return nil
+}
+
+// joinRecords lists pending join requests; nil unless we may manage accounts
+func (s *openSpace) joinRecords() ([]list.RequestRecord, error) {
+    acl := s.space.Acl()
+    acl.RLock()
+    defer acl.RUnlock()
+    st := acl.AclState()
+    if !st.Permissions(st.AccountKey().GetPublic()).CanManageAccounts() { return nil, nil }
+    return st.JoinRecords(false)
+}
+
+// UpdateAcl is the syncacl update hook (headupdater.AclUpdater). It runs
+// with the ACL locked, so it only wakes watchAcl.
+func (s *openSpace) UpdateAcl(list.AclList) { s.wakeAcl() }
+
+// wakeAcl makes watchAcl check the ACL again; it never blocks
+func (s *openSpace) wakeAcl() {
+    select {
+    case s.aclCh <- struct{}{}:
+    default:
+    }
+}
+
+// watchAcl announces join requests and ACL changes whenever syncacl adds
+// records, and keeps the request-to-join invite published
+func (s *openSpace) watchAcl(ctx context.Context, done chan struct{}) {
+    defer close(done)
+    defer recoverGo(s.crashRoot, "acl "+s.id)
+    for {
+        s.ensureRequestInvite(ctx)
+        s.emitJoinRequests()
+        s.emitAclChange()
+        select {
+        case <-ctx.Done():
+            return
+        case <-s.aclCh:
+        }
+    }
+}
+
+// emitJoinRequests sends a join_request event for every request not seen yet
+func (s *openSpace) emitJoinRequests() {
+    recs, err := s.joinRecords()
+    if err != nil { log.Printf("join requests %s: %v", s.id, err); return }
+    for _, r := range recs {
+        s.mu.Lock()
+        _, ok := s.seenRequests[r.RecordId]
+        s.seenRequests[r.RecordId] = struct{}{}
+        s.mu.Unlock()
+        if ok { continue }
+        b, _ := json.Marshal(JoinRequest{Type: joinRequestEvent, SpaceId: s.id, Identity: r.RequestIdentity.Account(), RecordId: r.RecordId, Timestamp: time.Now().UnixMilli()})
+        s.emit(string(b))
+    }
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestRequestInviteKey(t *testing.T) {
+    a, b := requestInviteKey("space-a"), requestInviteKey("space-a")
+    if !a.GetPublic().Equals(b.GetPublic()) { t.Fatal("request invite key differs for the same space") }
+    if a.GetPublic().Equals(requestInviteKey("space-b").GetPublic()) { t.Fatal("two spaces share a request invite key") }
+}
+
+func TestUpdateAclWakesWatch(t *testing.T) {
+    s := &openSpace{id: "a", aclCh: make(chan struct{}, 1)}
+    // the hook runs with the ACL locked and must never block
+    for i := 0; i < 3; i++ { s.UpdateAcl(nil) }
+    select {
+    case <-s.aclCh:
+    default:
+        t.Fatal("update did not wake the ACL watch")
+    }
+}
+
+func TestParseInvite(t *testing.T) {
+    inv := Invite{SpaceId: "a", InviteKey: "key"}
+    got, err := ParseInvite(inv.Encode())
+    if err != nil || got != inv { t.Fatalf("parsed %+v, %v", got, err) }
+    for _, payload := range []string{"", "{", `{"spaceId":"a"}`, `{"inviteKey":"k"}`} {
+        if _, err := ParseInvite(payload); !errors.Is(err, ErrInvalidArgument) { t.Errorf("%q: %v", payload, err) }
+    }
+}
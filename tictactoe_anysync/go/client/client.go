@@ -0,0 +1,536 @@
+// Package client is the any-sync TicTacToe client: app composition, account
+// keystore, space registry, operation log and rules engine. It is plain Go;
+// the cgo bridge in the parent directory is a thin adapter over it, and other
+// Go programs can embed it directly.
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strconv"
+    "sync"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace"
+    "github.com/anyproto/any-sync/commonspace/syncstatus"
+    "github.com/anyproto/any-sync/commonspace/acl/aclclient"
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+    "github.com/anyproto/any-sync/net/peerservice"
+    "github.com/anyproto/any-sync/net/pool"
+    rpcserver "github.com/anyproto/any-sync/net/rpc/server"
+    "github.com/anyproto/any-sync/net/streampool"
+    "github.com/anyproto/any-sync/net/transport/quic"
+    "github.com/anyproto/any-sync/net/transport/yamux"
+    "github.com/anyproto/any-sync/net/secureservice"
+    "github.com/anyproto/any-sync/node/nodeclient"
+    "github.com/anyproto/any-sync/consensus/consensusclient"
+    "github.com/anyproto/any-sync/coordinator/coordinatorclient"
+    "github.com/anyproto/any-sync/coordinator/nodeconfsource"
+    "github.com/anyproto/any-sync/nodeconf"
+    "github.com/anyproto/any-sync/testutil/accounttest"
+    "github.com/anyproto/any-sync/util/crypto"
+    "github.com/anyproto/any-sync/commonspace/spacepayloads"
+    acctsvc "github.com/anyproto/any-sync/accountservice"
+    syncqueues "github.com/anyproto/any-sync/util/syncqueues"
+)
+
+// ErrNotStarted is returned by space operations before Start
+var ErrNotStarted = errors.New("client is not started")
+
+// EventSink receives every operation seen in an open space, in local arrival
+// order per space. Dispatch must not block.
+type EventSink interface {
+    Dispatch(spaceId string, op string)
+}
+
+// Options configure a Client
+type Options struct {
+    // StorageRoot holds spaces/ and account.json; defaults to DefaultStorageRoot()
+    StorageRoot string
+    // Demo runs without any-sync (in-process echo), like ANYSYNC_DEMO_MODE=1
+    Demo bool
+    // Events receives operations from space listeners; may be nil
+    Events EventSink
+    // Storage selects the space storage backend; defaults to disk under StorageRoot/spaces
+    Storage StorageOptions
+    // LayoutDryRun only logs the layout migrations New would run; the client
+    // cannot start while they are pending, see MigrateLayout
+    LayoutDryRun bool
+}
+
+// Client is one independent instance: its own account, storage root,
+// any-sync app and open spaces. It is safe for concurrent use.
+type Client struct {
+    root string
+    forceDemo bool
+    events EventSink
+    storageOpts StorageOptions
+    // lifecycleMu serializes Start/Shutdown/Reconfigure; methods that use the
+    // running app hold it for reading
+    lifecycleMu sync.RWMutex
+    started bool
+    // set while a dry run left layout migrations to MigrateLayout
+    layoutPending bool
+    app *anyapp.App
+    spaceSvc commonspace.SpaceService
+    trees *treeManager
+    storage *fsSpaceStorageProvider
+    streams *streamHandler
+    demoMode bool
+    // unlocked keystore account, if any
+    accountMu sync.Mutex
+    account *keystoreAccount
+    // open spaces by id
+    spacesMu sync.RWMutex
+    spaces map[string]*openSpace
+    lastSpaceId string
+    // settings
+    nodeHost string
+    nodePort int
+    networkId string
+    // full node list from a client config; nil means a single tree node at nodeHost:nodePort
+    nodeConf *nodeconf.Configuration
+}
+
+// Status reports client-wide settings plus per-space sync status.
+// SpaceId/PeerCount/LastSyncMs mirror the most recently opened space.
+type Status struct {
+    SpaceId     string      `json:"spaceId"`
+    PeerCount   int         `json:"peerCount"`
+    LastSyncMs  int64       `json:"lastSyncMs"`
+    NodeHost    string      `json:"nodeHost"`
+    NodePort    int         `json:"nodePort"`
+    NetworkId   string      `json:"networkId"`
+    Connected   bool        `json:"connected"`
+    StorageRoot string      `json:"storageRoot"`
+    Spaces      []SpaceInfo `json:"spaces"`
+}
+
+// DefaultStorageRoot is ~/.tictactoe_anysync, with fallbacks for sandboxes
+func DefaultStorageRoot() string {
+    // Use a guaranteed user-writable dot folder to avoid sandbox redirects
+    if home, err := os.UserHomeDir(); err == nil && home != "" {
+        return filepath.Join(home, ".tictactoe_anysync")
+    }
+    if dir, err := os.UserCacheDir(); err == nil && dir != "" {
+        return filepath.Join(dir, "tictactoe_anysync")
+    }
+    return filepath.Join(".", "anysync_data")
+}
+
+// New creates a stopped client; call Start to run the any-sync app
+func New(opts Options) (*Client, error) {
+    if opts.StorageRoot == "" { opts.StorageRoot = DefaultStorageRoot() }
+    if err := opts.Storage.validate(); err != nil { return nil, err }
+    if err := os.MkdirAll(opts.StorageRoot, 0o700); err != nil { return nil, fmt.Errorf("storage root %s: %w", opts.StorageRoot, err) }
+    c := &Client{
+        root:      opts.StorageRoot,
+        forceDemo: opts.Demo,
+        events:    opts.Events,
+        storageOpts: opts.Storage,
+        spaces:    make(map[string]*openSpace),
+    }
+    rep, err := migrateLayout(c.layoutDirs(), !opts.LayoutDryRun)
+    rep.log()
+    if err != nil { return nil, err }
+    c.layoutPending = len(rep.Steps) > 0
+    return c, nil
+}
+
+// StorageRoot is the directory holding the keystore and spaces
+func (c *Client) StorageRoot() string { return c.root }
+
+// Started reports whether the app (or demo mode) is running
+func (c *Client) Started() bool {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    return c.started
+}
+
+// Start builds and runs the any-sync app. Starting a running client replaces
+// the previous app instead of leaking it. A network map stored by an earlier
+// run wins; host and port only bootstrap a network without one.
+func (c *Client) Start(host string, port int, network string) error {
+    c.lifecycleMu.Lock()
+    defer c.lifecycleMu.Unlock()
+    if err := c.layoutReady(); err != nil { return err }
+    if c.started {
+        if err := c.shutdown(context.Background()); err != nil { log.Printf("shutdown of previous app: %v", err) }
+    }
+    c.nodeConf = nil
+    return c.start(host, port, network)
+}
+
+// StartWithNodeConf is Start with the network described by conf (see
+// LoadClientConfig) instead of a single node address
+func (c *Client) StartWithNodeConf(conf nodeconf.Configuration) error {
+    if err := validateNodeConf(conf); err != nil { return err }
+    c.lifecycleMu.Lock()
+    defer c.lifecycleMu.Unlock()
+    if err := c.layoutReady(); err != nil { return err }
+    if c.started {
+        if err := c.shutdown(context.Background()); err != nil { log.Printf("shutdown of previous app: %v", err) }
+    }
+    c.nodeConf = &conf
+    // conf replaces the stored map only when it is newer; coordinator updates follow
+    if err := c.nodeConfStore().saveIfNewer(context.Background(), conf); err != nil { log.Printf("save node config: %v", err) }
+    host, port := treeNodeAddress(conf)
+    return c.start(host, port, conf.NetworkId)
+}
+
+// start builds and runs the any-sync app for this client. Callers hold
+// lifecycleMu for writing.
+func (c *Client) start(host string, port int, network string) error {
+    log.Printf("Initializing any-sync client: %s:%d, network: %s", host, port, network)
+    c.nodeHost, c.nodePort, c.networkId = host, port, network
+
+    // Demo mode: bypass any-sync and use in-process echo to avoid crashes while debugging
+    if c.forceDemo || os.Getenv("ANYSYNC_DEMO_MODE") == "1" {
+        log.Printf("Running in demo mode (no network, in-process echo)")
+        c.demoMode, c.started = true, true
+        return nil
+    }
+
+    cfg := &bridgeConfig{networkId: network, nodeHost: host, nodePort: port, nodeConf: c.nodeConf}
+    c.trees = newTreeManager(c.spaceForTrees)
+    c.streams = newStreamHandler(c.spaceForTrees, c.syncedSpaceIds, c.wakeSpace)
+    a := new(anyapp.App)
+    // Account: unlocked keystore first, then ANYSYNC_MNEMONIC (dev), otherwise ephemeral
+    var acct acctsvc.Service
+    // keys of a persistent identity; they also derive the at-rest store key
+    var keys *accountdata.AccountKeys
+    if ks := c.unlockedAccount(); ks != nil {
+        acct, keys = ks, ks.Account()
+        log.Printf("Using keystore account (peerId=%s)", ks.Account().PeerId)
+    } else if mnem := os.Getenv("ANYSYNC_MNEMONIC"); mnem != "" {
+        mk := crypto.Mnemonic(mnem)
+        base, err := mk.DeriveKeys(0)
+        if err != nil {
+            log.Printf("mnemonic derive error: %v (falling back to ephemeral account)", err)
+            acct = &accounttest.AccountTestService{}
+        } else {
+            idx := 0
+            if s := os.Getenv("ANYSYNC_PEER_INDEX"); s != "" {
+                if v, e := strconv.Atoi(s); e == nil { idx = v }
+            }
+            peerDeriv := base
+            if idx != 0 {
+                if d, e := mk.DeriveKeys(uint32(idx)); e == nil { peerDeriv = d }
+            }
+            peerId, _ := crypto.IdFromSigningPubKey(peerDeriv.MasterKey.GetPublic())
+            acc := &accountdata.AccountKeys{
+                PeerKey: peerDeriv.MasterKey,
+                // Share the same signing identity for ACL permissions
+                SignKey: base.Identity,
+                PeerId:  peerId.String(),
+            }
+            acct, keys = accounttest.NewWithAcc(acc), acc
+            log.Printf("Using deterministic account (peerId=%s, peerIndex=%d)", acc.PeerId, idx)
+        }
+    } else {
+        log.Printf("No unlocked account; using an ephemeral identity (unlock or create an account first)")
+        acct = &accounttest.AccountTestService{}
+    }
+
+    storage, err := c.newStorageProvider(keys)
+    if err != nil { return err }
+    c.storage = storage
+
+    a.Register(cfg).
+        Register(acct).
+        // Node configuration must be fully available before components that depend on it
+        // last known network map on disk, newer ones from the coordinator
+        Register(nodeconfsource.New()).
+        Register(c.nodeConfStore()).
+        Register(nodeconf.New()).
+        // Core networking
+        Register(pool.New()).
+        Register(coordinatorclient.New()).
+        Register(consensusclient.New()).
+        Register(c.streams).
+        Register(peerservice.New()).
+        Register(rpcserver.New()).
+        Register(secureservice.New()).
+        Register(streampool.New()).
+        Register(quic.New()).
+        Register(yamux.New()).
+        Register(nodeclient.New()).
+        Register(aclclient.NewAclJoiningClient()).
+        // Utilities and commonspace deps
+        Register(syncqueues.New()).
+        Register(&coordinatorCredentialProvider{}).
+        Register(c.trees).
+        Register(newPeerManagerProvider()).
+        Register(c.storage).
+        // Full space service (enables fetching remote storage and peering)
+        Register(commonspace.New())
+
+    // on failure Start already closes the components it managed to run
+    if err := a.Start(context.Background()); err != nil { c.trees, c.streams, c.storage = nil, nil, nil; return err }
+
+    c.app, c.spaceSvc, c.demoMode, c.started = a, anyapp.MustComponent[commonspace.SpaceService](a), false, true
+    // a stored map may point at other nodes than the bootstrap address
+    if h, p := treeNodeAddress(anyapp.MustComponent[nodeconf.Service](a).Configuration()); h != "" { c.nodeHost, c.nodePort = h, p }
+    return nil
+}
+
+// Shutdown stops every listener, closes all open spaces and then closes the
+// app, which in turn closes the storage provider and flushes its DBs.
+// Shutting down a stopped client is a no-op.
+func (c *Client) Shutdown(ctx context.Context) error {
+    c.lifecycleMu.Lock()
+    defer c.lifecycleMu.Unlock()
+    if !c.started { return nil }
+    return c.shutdown(ctx)
+}
+
+// shutdown is Shutdown for callers that hold lifecycleMu
+func (c *Client) shutdown(ctx context.Context) error {
+    c.spacesMu.Lock()
+    spaces := make([]*openSpace, 0, len(c.spaces))
+    for _, s := range c.spaces { spaces = append(spaces, s) }
+    c.spaces = make(map[string]*openSpace)
+    c.lastSpaceId = ""
+    c.spacesMu.Unlock()
+
+    var errs []error
+    for _, s := range spaces {
+        if c.trees != nil { c.trees.closeSpace(s.id) }
+        if err := s.close(); err != nil { errs = append(errs, err) }
+    }
+    if c.app != nil {
+        if err := c.app.Close(ctx); err != nil { errs = append(errs, err) }
+    }
+    c.app, c.spaceSvc, c.trees, c.streams, c.storage, c.started = nil, nil, nil, nil, nil, false
+    return errors.Join(errs...)
+}
+
+// Reconfigure tears the running app down and starts a new one with the given
+// node settings and the same account. Spaces that were open are reopened and
+// their listeners resumed. A node list loaded from a client config is
+// dropped; the map stored for the network is kept and wins over host and port.
+func (c *Client) Reconfigure(ctx context.Context, host string, port int, network string) error {
+    c.lifecycleMu.Lock()
+    defer c.lifecycleMu.Unlock()
+    if err := c.layoutReady(); err != nil { return err }
+
+    var reopen []SpaceInfo
+    if c.started {
+        reopen = c.ListSpaces()
+        if err := c.shutdown(ctx); err != nil { log.Printf("reconfigure: shutdown err: %v", err) }
+    }
+    c.nodeConf = nil
+    if err := c.start(host, port, network); err != nil { return err }
+
+    for _, in := range reopen {
+        var s *openSpace
+        var err error
+        if c.demoMode {
+            s = c.registerSpace(newDemoSpace(in.SpaceId, c.events))
+        } else if s, err = c.openSpace(ctx, in.SpaceId); err != nil {
+            log.Printf("reconfigure: reopen %s: %v", in.SpaceId, err)
+            continue
+        }
+        if in.Listening { s.startListening() }
+    }
+    log.Printf("Client reconfigured: %s:%d, network: %s", host, port, network)
+    return nil
+}
+
+// CreateSpace creates a tictactoe space, opens it, has the coordinator sign
+// it and pushes it to its responsible nodes
+func (c *Client) CreateSpace(ctx context.Context) (string, error) {
+    rep, err := c.CreateSpaceWithReport(ctx)
+    return rep.SpaceId, err
+}
+
+// CreateSpaceWithReport is CreateSpace plus the outcome of every stage. A
+// failed sign is an error (the space exists locally but the network would
+// reject it); a failed push is not, head sync pushes the space again.
+func (c *Client) CreateSpaceWithReport(ctx context.Context) (CreateReport, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    var rep CreateReport
+    if !c.started { return rep, ErrNotStarted }
+    if c.demoMode {
+        rep.SpaceId = fmt.Sprintf("demo-%d", time.Now().UnixNano())
+        c.registerSpace(newDemoSpace(rep.SpaceId, c.events))
+        rep.record(StageCreate, time.Now(), false, nil)
+        return rep, nil
+    }
+    keys := anyapp.MustComponent[acctsvc.Service](c.app)
+
+    start := time.Now()
+    id, err := c.createSpaceStorage(ctx, keys)
+    rep.SpaceId = id
+    rep.record(StageCreate, start, false, err)
+    if err != nil { return rep, &StageError{Stage: StageCreate, Err: err} }
+
+    start = time.Now()
+    opened, err := c.openSpace(ctx, id)
+    rep.record(StageOpen, start, false, err)
+    if err != nil { return rep, &StageError{Stage: StageOpen, Err: err} }
+
+    start = time.Now()
+    var credential []byte
+    if !c.hasCoordinator() {
+        rep.record(StageSign, start, true, nil)
+    } else {
+        desc, err := opened.space.Description(ctx)
+        if err == nil { credential, err = signSpace(ctx, anyapp.MustComponent[coordinatorclient.CoordinatorClient](c.app), keys, desc.SpaceHeader) }
+        rep.record(StageSign, start, false, err)
+        if err != nil { return rep, &StageError{Stage: StageSign, Err: fmt.Errorf("space %s: %w", id, err)} }
+    }
+
+    start = time.Now()
+    rep.record(StagePush, start, false, pushSpace(ctx, opened.space, credential))
+    // the nodes know the space now, so the request-to-join invite can be published
+    opened.wakeAcl()
+    return rep, nil
+}
+
+// createSpaceStorage generates the space keys and creates the local storage
+func (c *Client) createSpaceStorage(ctx context.Context, keys acctsvc.Service) (string, error) {
+    masterKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+    if err != nil { return "", fmt.Errorf("master key: %w", err) }
+    metaKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+    if err != nil { return "", fmt.Errorf("metadata key: %w", err) }
+    payload := spacepayloads.SpaceCreatePayload{
+        SigningKey:     keys.Account().SignKey,
+        SpaceType:      "tictactoe",
+        ReplicationKey: 1,
+        SpacePayload:   nil,
+        MasterKey:      masterKey,
+        ReadKey:        crypto.NewAES(),
+        MetadataKey:    metaKey,
+        Metadata:       []byte("tictactoe_meta"),
+    }
+    id, err := c.spaceSvc.CreateSpace(ctx, payload)
+    if err != nil { return "", fmt.Errorf("CreateSpace: %w", err) }
+    return id, nil
+}
+
+// JoinSpace opens an existing space; joining an open space is a no-op
+func (c *Client) JoinSpace(ctx context.Context, id string) error {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    if !c.started { return ErrNotStarted }
+    if c.demoMode {
+        c.registerSpace(newDemoSpace(id, c.events))
+        return nil
+    }
+    _, err := c.openSpace(ctx, id)
+    return err
+}
+
+// openSpace opens (or returns the already open) space and registers it
+func (c *Client) openSpace(ctx context.Context, id string) (*openSpace, error) {
+    if s, err := c.getSpace(id); err == nil { return s, nil }
+    ts := newTreeSyncer(c.root)
+    ix := newOpIndexer()
+    sp, err := c.spaceSvc.NewSpace(ctx, id, commonspace.Deps{
+        SyncStatus:     syncstatus.NewNoOpSyncStatus(),
+        TreeSyncer:     ts,
+        AccountService: anyapp.MustComponent[acctsvc.Service](c.app),
+        Indexer:        ix,
+    })
+    if err != nil { return nil, fmt.Errorf("NewSpace: %w", err) }
+    if err := sp.Init(ctx); err != nil { return nil, fmt.Errorf("Space.Init: %w", err) }
+    s, err := newOpenSpace(sp, ix, c.events, c.root)
+    if err != nil { _ = sp.Close(); return nil, err }
+    s.treeSync, s.streams = ts, c.streams
+    registered := c.registerSpace(s)
+    if registered == s {
+        ts.StartSync()
+        c.streams.subscribe(id)
+        s.startAclWatch()
+    }
+    return registered, nil
+}
+
+// PeerId is the local peer id ("demo" in demo mode)
+func (c *Client) PeerId() string {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    return c.localPeerId()
+}
+
+func (c *Client) localPeerId() string {
+    if c.demoMode || c.app == nil { return "demo" }
+    return anyapp.MustComponent[acctsvc.Service](c.app).Account().PeerId
+}
+
+// SendOperation validates the operation against the materialized board and
+// appends it to the space log under its own ops/<session>/<opId> key. Moves
+// and resets are first written to the session's object tree, which the board
+// is built from; when that write fails the operation is not sent.
+func (c *Client) SendOperation(ctx context.Context, spaceId string, op []byte) error {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.getSpace(spaceId)
+    if err != nil { return err }
+    if s.demo() || c.trees == nil { return s.sendOperation(ctx, c.localPeerId(), op) }
+    return c.sendWithTree(ctx, s, c.localPeerId(), op)
+}
+
+// ReadOperations returns the ordered log after sinceCursor (empty = full
+// history) and the entries it is missing because they could not be read
+func (c *Client) ReadOperations(ctx context.Context, spaceId string, sinceCursor string) (OpPage, error) {
+    page := OpPage{Operations: []OpEntry{}, Cursor: sinceCursor, Skipped: []SkippedOp{}}
+    s, err := c.getSpace(spaceId)
+    if err != nil { return page, err }
+    ops, err := s.readOperations(ctx, sinceCursor)
+    if err != nil { return page, err }
+    page.Operations = append(page.Operations, ops...)
+    page.Skipped = s.log.skippedOps()
+    if n := len(page.Operations); n > 0 { page.Cursor = page.Operations[n-1].Cursor }
+    return page, nil
+}
+
+// BoardState materializes the latest game session of the space from its
+// session tree; demo spaces replay their op log
+func (c *Client) BoardState(ctx context.Context, spaceId string) (*BoardState, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.getSpace(spaceId)
+    if err != nil { return nil, err }
+    if !s.demo() && c.trees != nil { return c.latestBoard(ctx, s) }
+    entries, err := s.readOperations(ctx, "")
+    if err != nil { return nil, err }
+    return materializeBoard(entries), nil
+}
+
+// StartListening starts the space listener, which feeds the EventSink
+func (c *Client) StartListening(spaceId string) error {
+    s, err := c.getSpace(spaceId)
+    if err != nil { return err }
+    s.startListening()
+    log.Printf("Listening for operations in space: %s", s.id)
+    return nil
+}
+
+// Status is a snapshot of settings and open spaces
+func (c *Client) Status() Status {
+    st := Status{Spaces: c.ListSpaces(), StorageRoot: c.root}
+    c.spacesMu.RLock()
+    last := c.lastSpaceId
+    c.spacesMu.RUnlock()
+    for _, in := range st.Spaces {
+        if in.SpaceId != last { continue }
+        st.SpaceId = in.SpaceId
+        st.PeerCount = in.PeerCount
+        st.LastSyncMs = in.LastSyncMs
+    }
+    c.lifecycleMu.RLock()
+    st.NodeHost = c.nodeHost
+    st.NodePort = c.nodePort
+    st.NetworkId = c.networkId
+    st.Connected = c.started
+    c.lifecycleMu.RUnlock()
+    return st
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+    "fmt"
+    "net"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    spaceconfig "github.com/anyproto/any-sync/commonspace/config"
+    rpccfg "github.com/anyproto/any-sync/net/rpc"
+    "github.com/anyproto/any-sync/net/streampool"
+    "github.com/anyproto/any-sync/net/transport/quic"
+    "github.com/anyproto/any-sync/net/transport/yamux"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+// The config component of the any-sync client app: node addresses, transport
+// and space settings. The storage provider lives in storage.go.
+
+// config component aggregating required getters
+type bridgeConfig struct{
+    networkId string
+    nodeHost string
+    nodePort int
+    // loaded from a client config; preferred over nodeHost/nodePort
+    nodeConf *nodeconf.Configuration
+}
+
+func (c *bridgeConfig) Init(a *anyapp.App) error { return nil }
+func (c *bridgeConfig) Name() string { return "config" }
+
+func (c *bridgeConfig) GetNodeConf() nodeconf.Configuration {
+    if c.nodeConf != nil { return *c.nodeConf }
+    base := net.JoinHostPort(c.nodeHost, fmt.Sprintf("%d", c.nodePort))
+    // Provide both QUIC and YAMUX schemes; peerservice can choose
+    addrs := []string{
+        "quic://" + base,
+        "yamux://" + base,
+    }
+    return nodeconf.Configuration{
+        Id:        c.networkId,
+        NetworkId: c.networkId,
+        Nodes: []nodeconf.Node{
+            { PeerId: "node-1", Addresses: addrs, Types: []nodeconf.NodeType{nodeconf.NodeTypeTree} },
+        },
+    }
+}
+
+func (c *bridgeConfig) GetDrpc() rpccfg.Config { return rpccfg.Config{} }
+func (c *bridgeConfig) GetYamux() yamux.Config { return yamux.Config{} }
+func (c *bridgeConfig) GetQuic() quic.Config   { return quic.Config{} }
+func (c *bridgeConfig) GetSpace() spaceconfig.Config {
+    // Reduce background sync activity for demo stability
+    return spaceconfig.Config{ GCTTL: 60, SyncPeriod: 0, KeepTreeDataInMemory: true }
+}
+func (c *bridgeConfig) GetStreamConfig() streampool.StreamConfig {
+    return streampool.StreamConfig{
+        SendQueueSize:   256,
+        DialQueueWorkers: 4,
+        DialQueueSize:   64,
+    }
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    acctsvc "github.com/anyproto/any-sync/accountservice"
+    "github.com/anyproto/any-sync/commonspace"
+    "github.com/anyproto/any-sync/commonspace/credentialprovider"
+    "github.com/anyproto/any-sync/commonspace/spacesyncproto"
+    "github.com/anyproto/any-sync/coordinator/coordinatorclient"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+// Spaces are registered the way the official clients do it: the coordinator
+// signs the space header (a receipt binding it to our identity and network),
+// then the space is pushed to its responsible tree nodes with that receipt as
+// the credential. Networks without a coordinator (a single dev node given as
+// host/port) skip signing and push without a credential.
+
+// CreateStage names one step of CreateSpace
+type CreateStage string
+
+const (
+    StageCreate CreateStage = "create" // local space storage
+    StageOpen   CreateStage = "open"   // space opened and registered
+    StageSign   CreateStage = "sign"   // coordinator receipt
+    StagePush   CreateStage = "push"   // responsible tree nodes
+)
+
+// StageReport is the outcome of one CreateSpace step
+type StageReport struct {
+    Stage      CreateStage `json:"stage"`
+    Ok         bool        `json:"ok"`
+    Skipped    bool        `json:"skipped,omitempty"`
+    Error      string      `json:"error,omitempty"`
+    DurationMs int64       `json:"durationMs"`
+}
+
+// CreateReport lists the steps CreateSpace went through, in order
+type CreateReport struct {
+    SpaceId string        `json:"spaceId"`
+    Stages  []StageReport `json:"stages"`
+}
+
+// StageError is a CreateSpace failure; it unwraps to the stage's cause
+type StageError struct {
+    Stage CreateStage
+    Err   error
+}
+
+func (e *StageError) Error() string { return fmt.Sprintf("%s: %v", e.Stage, e.Err) }
+func (e *StageError) Unwrap() error { return e.Err }
+
+func (r *CreateReport) record(stage CreateStage, start time.Time, skipped bool, err error) {
+    rep := StageReport{Stage: stage, Ok: err == nil, Skipped: skipped, DurationMs: time.Since(start).Milliseconds()}
+    if err != nil { rep.Error = err.Error() }
+    r.Stages = append(r.Stages, rep)
+    switch {
+    case err != nil:
+        log.Printf("Create space %s: %s failed: %v", r.SpaceId, stage, err)
+    case skipped:
+        log.Printf("Create space %s: %s skipped", r.SpaceId, stage)
+    default:
+        log.Printf("Create space %s: %s done in %d ms", r.SpaceId, stage, rep.DurationMs)
+    }
+}
+
+// hasCoordinator reports whether the network map lists a coordinator node
+func (c *Client) hasCoordinator() bool {
+    return len(anyapp.MustComponent[nodeconf.Service](c.app).CoordinatorPeers()) > 0
+}
+
+// signSpace asks the coordinator for the space receipt and returns it marshaled
+func signSpace(ctx context.Context, coord coordinatorclient.CoordinatorClient, keys acctsvc.Service, header *spacesyncproto.RawSpaceHeaderWithId) ([]byte, error) {
+    acc := keys.Account()
+    receipt, err := coord.SpaceSign(ctx, coordinatorclient.SpaceSignPayload{
+        SpaceId:     header.Id,
+        SpaceHeader: header.RawHeader,
+        OldAccount:  acc.SignKey,
+        Identity:    acc.SignKey,
+    })
+    if err != nil { return nil, err }
+    return receipt.Marshal()
+}
+
+// pushSpace sends the space to every responsible node; it succeeds when at
+// least one accepts it and head sync retries the rest
+func pushSpace(ctx context.Context, sp commonspace.Space, credential []byte) error {
+    peers, err := sp.GetNodePeers(ctx)
+    if err != nil { return err }
+    if len(peers) == 0 { return fmt.Errorf("no responsible nodes for %s", sp.Id()) }
+    desc, err := sp.Description(ctx)
+    if err != nil { return err }
+    req := &spacesyncproto.SpacePushRequest{
+        Payload: &spacesyncproto.SpacePayload{
+            SpaceHeader:            desc.SpaceHeader,
+            AclPayload:             desc.AclPayload,
+            AclPayloadId:           desc.AclId,
+            SpaceSettingsPayload:   desc.SpaceSettingsPayload,
+            SpaceSettingsPayloadId: desc.SpaceSettingsId,
+        },
+        Credential: credential,
+    }
+    var errs []error
+    accepted := 0
+    for _, p := range peers {
+        conn, err := p.AcquireDrpcConn(ctx)
+        if err == nil {
+            _, err = spacesyncproto.NewDRPCSpaceSyncClient(conn).SpacePush(ctx, req)
+            p.ReleaseDrpcConn(ctx, conn)
+        }
+        if err != nil { errs = append(errs, fmt.Errorf("node %s: %w", p.Id(), err)); continue }
+        accepted++
+    }
+    if accepted == 0 { return errors.Join(errs...) }
+    for _, err := range errs { log.Printf("space push %s: %v", sp.Id(), err) }
+    return nil
+}
+
+// coordinatorCredentialProvider signs spaces with the coordinator when head
+// sync finds a space missing on a node and pushes it again
+type coordinatorCredentialProvider struct {
+    coord coordinatorclient.CoordinatorClient
+    nodes nodeconf.Service
+    keys  acctsvc.Service
+}
+
+func (p *coordinatorCredentialProvider) Init(a *anyapp.App) error {
+    p.coord = anyapp.MustComponent[coordinatorclient.CoordinatorClient](a)
+    p.nodes = anyapp.MustComponent[nodeconf.Service](a)
+    p.keys = anyapp.MustComponent[acctsvc.Service](a)
+    return nil
+}
+
+func (p *coordinatorCredentialProvider) Name() string { return credentialprovider.CName }
+
+func (p *coordinatorCredentialProvider) GetCredential(ctx context.Context, header *spacesyncproto.RawSpaceHeaderWithId) ([]byte, error) {
+    if len(p.nodes.CoordinatorPeers()) == 0 { return nil, nil }
+    return signSpace(ctx, p.coord, p.keys, header)
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "runtime/debug"
+    "time"
+)
+
+// A panic in any goroutine aborts the host process (the Flutter app), not
+// just the bridge. Exports recover in the bridge (panics.go); goroutines the
+// client starts itself (space listeners, tree sync workers, the storage
+// sweeper) defer recoverGo, which writes the same crash report under the
+// storage root and lets only that goroutine end.
+
+// CrashDir is the directory under the storage root holding crash reports
+const CrashDir = "crash"
+
+// WriteCrashReport stores <root>/crash/crash-<time>.txt and returns its path
+func WriteCrashReport(root, op string, handle int64, perr *PanicError) (string, error) {
+    dir := filepath.Join(root, CrashDir)
+    if err := os.MkdirAll(dir, 0o700); err != nil { return "", err }
+    now := time.Now()
+    path := filepath.Join(dir, fmt.Sprintf("crash-%s-%09d.txt", now.Format("20060102-150405"), now.Nanosecond()))
+    report := fmt.Sprintf("time: %s\nop: %s\nhandle: %d\npanic: %v\n\n%s", now.Format(time.RFC3339Nano), op, handle, perr.Value, perr.Stack)
+    if err := os.WriteFile(path, []byte(report), 0o600); err != nil { return "", err }
+    return path, nil
+}
+
+// reportPanic logs a recovered panic of a background goroutine and writes its
+// crash report
+func reportPanic(root, name string, r any) *PanicError {
+    perr := &PanicError{Value: r, Stack: debug.Stack()}
+    path, err := WriteCrashReport(root, name, 0, perr)
+    if err != nil { log.Printf("%s: %v (crash report: %v)", name, perr, err); return perr }
+    log.Printf("%s: %v (crash report %s)", name, perr, path)
+    return perr
+}
+
+// recoverGo is deferred by background goroutines
+func recoverGo(root, name string) {
+    if r := recover(); r != nil { reportPanic(root, name, r) }
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestWriteCrashReport(t *testing.T) {
+    root := t.TempDir()
+    path, err := WriteCrashReport(root, "send operation", 7, &PanicError{Value: "boom", Stack: []byte("goroutine 1")})
+    if err != nil { t.Fatal(err) }
+    if filepath.Dir(path) != filepath.Join(root, CrashDir) { t.Fatalf("report at %s", path) }
+    if p := perm(t, path); p != 0o600 { t.Fatalf("report is %#o", p) }
+    b, err := os.ReadFile(path)
+    if err != nil { t.Fatal(err) }
+    for _, want := range []string{"op: send operation\n", "handle: 7\n", "panic: boom\n", "goroutine 1"} {
+        if !strings.Contains(string(b), want) { t.Fatalf("report lacks %q:\n%s", want, b) }
+    }
+    // reports never overwrite each other
+    second, err := WriteCrashReport(root, "x", 0, &PanicError{Value: 1})
+    if err != nil || second == path { t.Fatalf("second report %s, %v", second, err) }
+}
+
+func TestRecoverGo(t *testing.T) {
+    root := t.TempDir()
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        defer recoverGo(root, "listener")
+        var m map[string]int
+        m["x"] = 1
+    }()
+    <-done
+    reports, err := os.ReadDir(filepath.Join(root, CrashDir))
+    if err != nil || len(reports) != 1 { t.Fatalf("reports %v, %v", reports, err) }
+    b, err := os.ReadFile(filepath.Join(root, CrashDir, reports[0].Name()))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "op: listener\n") || !strings.Contains(string(b), "nil map") { t.Fatalf("report:\n%s", b) }
+
+    // a goroutine that returns normally writes nothing
+    func() { defer recoverGo(root, "quiet") }()
+    if reports, _ := os.ReadDir(filepath.Join(root, CrashDir)); len(reports) != 1 { t.Fatalf("%d reports", len(reports)) }
+}
+
+func TestPanicError(t *testing.T) {
+    err := error(&PanicError{Value: "nil map", Stack: []byte("stack")})
+    if !errors.Is(err, ErrPanic) || err.Error() != "panic: nil map" { t.Fatalf("panic error %v", err) }
+    var perr *PanicError
+    if !errors.As(fmt.Errorf("op: %w", err), &perr) || string(perr.Stack) != "stack" { t.Fatal("panic error lost in a wrap") }
+}
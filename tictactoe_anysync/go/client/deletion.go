@@ -0,0 +1,107 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    acctsvc "github.com/anyproto/any-sync/accountservice"
+    "github.com/anyproto/any-sync/commonspace/object/acl/list"
+    "github.com/anyproto/any-sync/coordinator/coordinatorclient"
+    "github.com/anyproto/any-sync/coordinator/coordinatorproto"
+    "github.com/anyproto/any-sync/net/peer"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+// Leaving drops a space from this device only; deleting removes it from the
+// network. Deletion marks every tree deleted through the space deletion
+// manager (settings object), appends a space_deleted op so listening peers
+// learn about it right away, and asks the coordinator to delete the space,
+// which makes the nodes drop it. Both end with the local store.db removed.
+
+const opTypeSpaceDeleted = "space_deleted"
+
+// removeLocalSpace closes the space if it is open and removes its storage.
+// Callers hold lifecycleMu for reading.
+func (c *Client) removeLocalSpace(ctx context.Context, id string) error {
+    if _, err := c.getSpace(id); err == nil {
+        if err := c.closeSpace(id); err != nil { log.Printf("close %s: %v", id, err) }
+    }
+    if c.storage != nil { return c.storage.DeleteSpaceStorage(ctx, id) }
+    // not started: nothing holds the DB open
+    if c.storageOpts.Backend == StorageMemory { return nil }
+    return os.RemoveAll(filepath.Join(c.spacesRoot(), id))
+}
+
+// LeaveSpace closes the space and removes its local data. Members other than
+// the owner first ask the owner to remove them from the ACL; when that
+// request fails the space stays open and on disk so leaving can be retried.
+func (c *Client) LeaveSpace(ctx context.Context, id string) error {
+    if id == "" { return fmt.Errorf("%w: empty space id", ErrInvalidArgument) }
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    if s, err := c.getSpace(id); err == nil && !s.demo() && !s.isOwner() {
+        if err := s.space.AclClient().RequestSelfRemove(ctx); err != nil { return fmt.Errorf("leave %s: self remove request: %w", id, err) }
+    }
+    return c.removeLocalSpace(ctx, id)
+}
+
+// DeleteSpace deletes an open space from the network and this device; only
+// the owner may delete
+func (c *Client) DeleteSpace(ctx context.Context, id string) error {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    if !c.started { return ErrNotStarted }
+    s, err := c.getSpace(id)
+    if err != nil { return err }
+    if s.demo() { return c.removeLocalSpace(ctx, id) }
+    if !s.isOwner() { return fmt.Errorf("delete %s: %w", id, list.ErrInsufficientPermissions) }
+
+    // tell listening peers first, while the space still syncs
+    op, _ := json.Marshal(map[string]any{"type": opTypeSpaceDeleted, "spaceId": id, "timestamp": time.Now().UnixMilli()})
+    s.sendMu.Lock()
+    err = s.appendLocked(ctx, c.localPeerId(), op)
+    s.sendMu.Unlock()
+    if err != nil { log.Printf("delete %s: announce: %v", id, err) }
+    s.syncNow(ctx)
+
+    for _, treeId := range s.space.StoredIds() {
+        if err := s.space.DeleteTree(ctx, treeId); err != nil { log.Printf("delete %s: tree %s: %v", id, treeId, err) }
+    }
+
+    if c.hasCoordinator() {
+        keys := anyapp.MustComponent[acctsvc.Service](c.app).Account()
+        networkId := anyapp.MustComponent[nodeconf.Service](c.app).Configuration().NetworkId
+        conf, err := coordinatorproto.PrepareDeleteConfirmation(keys.SignKey, id, keys.PeerId, networkId)
+        if err != nil { return fmt.Errorf("delete %s: confirmation: %w", id, err) }
+        if err := anyapp.MustComponent[coordinatorclient.CoordinatorClient](c.app).SpaceDelete(ctx, id, conf); err != nil {
+            return fmt.Errorf("delete %s: coordinator: %w", id, err)
+        }
+    }
+    return c.removeLocalSpace(ctx, id)
+}
+
+// isOwner reports whether our identity owns the space
+func (s *openSpace) isOwner() bool {
+    acl := s.space.Acl()
+    acl.RLock()
+    defer acl.RUnlock()
+    st := acl.AclState()
+    return st.Permissions(st.AccountKey().GetPublic()).IsOwner()
+}
+
+// syncNow pushes the KeyValue store to the node peers once
+func (s *openSpace) syncNow(ctx context.Context) {
+    peers, err := s.space.GetNodePeers(ctx)
+    if err != nil { return }
+    kv, ok := s.kvSync.(interface{ SyncWithPeer(peer.Peer) error })
+    if !ok { return }
+    for _, p := range peers {
+        if err := kv.SyncWithPeer(p); err != nil { log.Printf("sync %s with %s: %v", s.id, p.Id(), err) }
+    }
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "os"
+
+    "github.com/anyproto/any-sync/commonspace/object/acl/list"
+    "github.com/anyproto/any-sync/commonspace/spacestorage"
+    "github.com/anyproto/any-sync/coordinator/coordinatorproto"
+    anynet "github.com/anyproto/any-sync/net"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+// Code is a stable, machine-readable error category. Codes are part of the
+// FFI contract: new ones may be added, existing ones never change meaning.
+type Code string
+
+const (
+    CodeOK              Code = "ok"
+    CodeInternal        Code = "internal"
+    CodeInvalidHandle   Code = "invalid_handle"
+    CodeInvalidArgument Code = "invalid_argument"
+    CodeNotStarted      Code = "not_started"
+    CodeSpaceNotOpen    Code = "space_not_open"
+    CodeSpaceNotFound   Code = "space_not_found"
+    CodeSpaceExists     Code = "space_exists"
+    CodeNetworkNotFound Code = "network_config_not_found"
+    CodeNodeUnreachable Code = "node_unreachable"
+    CodeTimeout         Code = "timeout"
+    CodeCanceled        Code = "canceled"
+    CodeKeystoreMissing Code = "keystore_missing"
+    CodeKeystoreExists  Code = "keystore_exists"
+    CodeBadPassphrase   Code = "bad_passphrase"
+    CodeKeystoreCorrupt Code = "keystore_corrupt"
+    CodeInvalidMove     Code = "invalid_move"
+    CodeStorage         Code = "storage"
+    CodeForbidden       Code = "forbidden"
+    CodeSpaceLimit      Code = "space_limit_reached"
+    CodeStoreKey        Code = "store_key_mismatch"
+    CodeLayout          Code = "layout_unsupported"
+    CodeLayoutPending   Code = "layout_pending"
+    CodePanic           Code = "panic"
+)
+
+// ErrInvalidArgument marks malformed input such as unparsable operation JSON
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// ErrPanic is matched by every PanicError
+var ErrPanic = errors.New("panic")
+
+// PanicError carries a recovered panic value and the stack it was raised on
+type PanicError struct {
+    Value any
+    Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+func (e *PanicError) Unwrap() error { return ErrPanic }
+
+var codeBySentinel = []struct {
+    err  error
+    code Code
+}{
+    {ErrPanic, CodePanic},
+    {ErrNotStarted, CodeNotStarted},
+    {ErrSpaceNotOpen, CodeSpaceNotOpen},
+    {ErrInvalidArgument, CodeInvalidArgument},
+    {ErrKeystoreMissing, CodeKeystoreMissing},
+    {ErrKeystoreExists, CodeKeystoreExists},
+    {ErrBadPassphrase, CodeBadPassphrase},
+    {ErrKeystoreCorrupt, CodeKeystoreCorrupt},
+    {ErrStoreKey, CodeStoreKey},
+    {ErrLayoutUnsupported, CodeLayout},
+    {ErrLayoutPending, CodeLayoutPending},
+    {ErrBadPosition, CodeInvalidMove},
+    {ErrOccupied, CodeInvalidMove},
+    {ErrNotYourTurn, CodeInvalidMove},
+    {ErrGameOver, CodeInvalidMove},
+    {ErrStaleSession, CodeInvalidMove},
+    {ErrNoSeat, CodeInvalidMove},
+    {ErrNotSeatOwner, CodeInvalidMove},
+    {spacestorage.ErrSpaceStorageMissing, CodeSpaceNotFound},
+    {spacestorage.ErrSpaceStorageExists, CodeSpaceExists},
+    {nodeconf.ErrConfigurationNotFound, CodeNetworkNotFound},
+    {coordinatorproto.ErrSpaceIsCreated, CodeSpaceExists},
+    {coordinatorproto.ErrSpaceNotExists, CodeSpaceNotFound},
+    {coordinatorproto.ErrForbidden, CodeForbidden},
+    {list.ErrInsufficientPermissions, CodeForbidden},
+    {coordinatorproto.ErrSpaceLimitReached, CodeSpaceLimit},
+    {anynet.ErrUnableToConnect, CodeNodeUnreachable},
+    {context.DeadlineExceeded, CodeTimeout},
+    {context.Canceled, CodeCanceled},
+}
+
+// ErrorCode classifies err; the first matching sentinel in the chain wins
+func ErrorCode(err error) Code {
+    if err == nil { return CodeOK }
+    for _, s := range codeBySentinel {
+        if errors.Is(err, s.err) { return s.code }
+    }
+    var syntaxErr *json.SyntaxError
+    var typeErr *json.UnmarshalTypeError
+    if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) { return CodeInvalidArgument }
+    // before net.Error: the syscall.Errno a PathError wraps is one too
+    var pathErr *os.PathError
+    if errors.As(err, &pathErr) { return CodeStorage }
+    var netErr net.Error
+    if errors.As(err, &netErr) {
+        if netErr.Timeout() { return CodeTimeout }
+        return CodeNodeUnreachable
+    }
+    return CodeInternal
+}
+
+// ErrorCauses flattens the wrap chain of err, outermost first. Joined errors
+// contribute each of their branches in order.
+func ErrorCauses(err error) []string {
+    var out []string
+    var walk func(error)
+    walk = func(e error) {
+        for e != nil {
+            out = append(out, e.Error())
+            switch u := e.(type) {
+            case interface{ Unwrap() []error }:
+                for _, b := range u.Unwrap() { walk(b) }
+                return
+            case interface{ Unwrap() error }:
+                e = u.Unwrap()
+            default:
+                return
+            }
+        }
+    }
+    walk(err)
+    return out
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "os"
+    "reflect"
+    "testing"
+
+    "github.com/anyproto/any-sync/commonspace/spacestorage"
+    anynet "github.com/anyproto/any-sync/net"
+)
+
+// timeoutErr is a net.Error that may time out
+type timeoutErr bool
+
+func (e timeoutErr) Error() string   { return "net" }
+func (e timeoutErr) Timeout() bool   { return bool(e) }
+func (e timeoutErr) Temporary() bool { return false }
+
+func TestErrorCode(t *testing.T) {
+    jsonErr := json.Unmarshal([]byte("{"), &struct{}{})
+    _, pathErr := os.Open("/nonexistent/file")
+    tests := []struct {
+        name string
+        err  error
+        want Code
+    }{
+        {"nil", nil, CodeOK},
+        {"unknown", errors.New("boom"), CodeInternal},
+        {"sentinel", ErrSpaceNotOpen, CodeSpaceNotOpen},
+        {"wrapped sentinel", fmt.Errorf("send: %w", ErrNotStarted), CodeNotStarted},
+        {"game rule", fmt.Errorf("move: %w", ErrNoSeat), CodeInvalidMove},
+        {"any-sync sentinel", fmt.Errorf("open: %w", spacestorage.ErrSpaceStorageMissing), CodeSpaceNotFound},
+        {"deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), CodeTimeout},
+        {"canceled", context.Canceled, CodeCanceled},
+        {"json syntax", jsonErr, CodeInvalidArgument},
+        {"net timeout", &net.OpError{Op: "dial", Err: timeoutErr(true)}, CodeTimeout},
+        {"net refused", &net.OpError{Op: "dial", Err: timeoutErr(false)}, CodeNodeUnreachable},
+        {"no reachable node", fmt.Errorf("peers: %w", anynet.ErrUnableToConnect), CodeNodeUnreachable},
+        {"path", pathErr, CodeStorage},
+        // a panic is reported as one, whatever it wraps
+        {"panic", fmt.Errorf("listener: %w", &PanicError{Value: ErrSpaceNotOpen}), CodePanic},
+        // the first sentinel of the table wins over later ones in the chain
+        {"joined", errors.Join(ErrStoreKey, ErrNotStarted), CodeNotStarted},
+        // a sentinel wins over the type checks
+        {"sentinel and path", fmt.Errorf("%w: %w", ErrLayoutPending, pathErr), CodeLayoutPending},
+    }
+    for _, tt := range tests {
+        if got := ErrorCode(tt.err); got != tt.want { t.Errorf("%s: %s, want %s", tt.name, got, tt.want) }
+    }
+}
+
+func TestErrorCauses(t *testing.T) {
+    inner := errors.New("inner")
+    err := fmt.Errorf("outer: %w", errors.Join(fmt.Errorf("a: %w", inner), errors.New("b")))
+    want := []string{err.Error(), "a: inner\nb", "a: inner", "inner", "b"}
+    if got := ErrorCauses(err); !reflect.DeepEqual(got, want) { t.Fatalf("causes %q, want %q", got, want) }
+    if got := ErrorCauses(nil); got != nil { t.Fatalf("causes of nil %q", got) }
+}
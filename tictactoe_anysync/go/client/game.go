@@ -0,0 +1,206 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+)
+
+// Authoritative TicTacToe rules. The board is never trusted from clients: it
+// is rebuilt from the operation log, or from the session tree of the latest
+// session where spaces have trees (gametree.go), so every peer that has the
+// same log ends up with the same board, turn and winner. Concurrent moves on the same cell
+// are resolved by the order of the entries replayed: the first one wins and
+// later ones are reported as rejected. A seat belongs to the signer of the
+// move that took it (the peer of a log entry, the identity of a tree change);
+// moves of that player signed by anyone else are rejected, so a peer cannot
+// play for another by writing their playerId.
+
+const (
+    opTypeMove  = "tictactoe_move"
+    opTypeReset = "tictactoe_reset"
+    boardCells  = 9
+    seatCount   = 2
+)
+
+// Move validation errors, wrapped by SendOperation
+var (
+    ErrBadPosition  = errors.New("position out of range")
+    ErrOccupied     = errors.New("cell already occupied")
+    ErrNotYourTurn  = errors.New("not this player's turn")
+    ErrGameOver     = errors.New("game is over")
+    ErrStaleSession = errors.New("move belongs to another session")
+    ErrNoSeat       = errors.New("both seats are taken")
+    ErrNotSeatOwner = errors.New("move signed by someone other than the seat's player")
+)
+
+var winLines = [8][3]int{
+    {0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+    {0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+    {0, 4, 8}, {2, 4, 6},
+}
+
+var seatSymbols = [seatCount]string{"X", "O"}
+
+type gameOp struct {
+    Type      string `json:"type"`
+    Id        string `json:"id"`
+    Position  *int   `json:"position"`
+    PlayerId  string `json:"playerId"`
+    Timestamp int64  `json:"timestamp"`
+    SessionId int64  `json:"sessionId"`
+}
+
+// Move is an accepted tictactoe_move in log order. Cursor is the op log
+// cursor, or the change id when the board was read from a session tree.
+type Move struct {
+    Id        string `json:"id"`
+    Position  int    `json:"position"`
+    PlayerId  string `json:"playerId"`
+    Timestamp int64  `json:"timestamp"`
+    Cursor    string `json:"cursor"`
+}
+
+// RejectedMove is a logged move that lost against the rules, e.g. a
+// concurrent move on an already taken cell
+type RejectedMove struct {
+    Move
+    Reason string `json:"reason"`
+}
+
+// BoardState is the board materialized from the operation log
+type BoardState struct {
+    SessionId int64          `json:"sessionId"`
+    Board     []string       `json:"board"`
+    Symbols   []string       `json:"symbols"`
+    Players   []string       `json:"players"`
+    Turn      string         `json:"turn"`
+    Winner    string         `json:"winner"`
+    Draw      bool           `json:"draw"`
+    Moves     []Move         `json:"moves"`
+    Rejected  []RejectedMove `json:"rejected"`
+    // signer of each seat, parallel to Players; empty when unknown
+    owners []string
+}
+
+func newBoardState(session int64) *BoardState {
+    return &BoardState{
+        SessionId: session,
+        Board:     make([]string, boardCells),
+        Symbols:   make([]string, boardCells),
+        Players:   []string{},
+        Moves:     []Move{},
+        Rejected:  []RejectedMove{},
+    }
+}
+
+func (b *BoardState) over() bool { return b.Winner != "" || b.Draw }
+
+func (b *BoardState) seat(playerId string) int {
+    for i, p := range b.Players {
+        if p == playerId { return i }
+    }
+    return -1
+}
+
+// validateMove checks a move signed by signer against the current state
+// without applying it; an empty signer skips the seat owner check
+func (b *BoardState) validateMove(op gameOp, signer string) error {
+    if op.Position == nil || *op.Position < 0 || *op.Position >= boardCells { return ErrBadPosition }
+    if op.SessionId != b.SessionId { return ErrStaleSession }
+    if b.over() { return ErrGameOver }
+    if b.Board[*op.Position] != "" { return ErrOccupied }
+    seat := b.seat(op.PlayerId)
+    if seat < 0 && len(b.Players) >= seatCount { return ErrNoSeat }
+    if seat >= 0 && signer != "" && b.owners[seat] != "" && b.owners[seat] != signer { return ErrNotSeatOwner }
+    if seat < 0 { seat = len(b.Players) }
+    if seat != len(b.Moves)%seatCount { return ErrNotYourTurn }
+    return nil
+}
+
+func (b *BoardState) applyMove(op gameOp, cursor, signer string) error {
+    if err := b.validateMove(op, signer); err != nil { return err }
+    if b.seat(op.PlayerId) < 0 {
+        b.Players = append(b.Players, op.PlayerId)
+        b.owners = append(b.owners, signer)
+    }
+    pos := *op.Position
+    b.Board[pos] = op.PlayerId
+    b.Symbols[pos] = seatSymbols[b.seat(op.PlayerId)]
+    b.Moves = append(b.Moves, Move{Id: op.Id, Position: pos, PlayerId: op.PlayerId, Timestamp: op.Timestamp, Cursor: cursor})
+    b.updateOutcome()
+    return nil
+}
+
+func (b *BoardState) updateOutcome() {
+    for _, l := range winLines {
+        if p := b.Board[l[0]]; p != "" && p == b.Board[l[1]] && p == b.Board[l[2]] {
+            b.Winner = p
+            b.Turn = ""
+            return
+        }
+    }
+    if len(b.Moves) == boardCells {
+        b.Draw = true
+        b.Turn = ""
+        return
+    }
+    if next := len(b.Moves) % seatCount; next < len(b.Players) {
+        b.Turn = b.Players[next]
+    } else {
+        b.Turn = ""
+    }
+}
+
+// latestSession is the highest session of the moves and resets in entries; 1
+// before the first reset
+func latestSession(entries []OpEntry) int64 {
+    var current int64 = 1
+    for _, e := range entries {
+        var op gameOp
+        if json.Unmarshal(e.Op, &op) != nil { continue }
+        if (op.Type == opTypeReset || op.Type == opTypeMove) && op.SessionId > current { current = op.SessionId }
+    }
+    return current
+}
+
+// materializeBoard replays the log and returns the state of the latest session
+func materializeBoard(entries []OpEntry) *BoardState {
+    return materializeSession(entries, latestSession(entries))
+}
+
+// materializeSession replays the moves of one session in entry order; the
+// PeerId of an entry is its signer
+func materializeSession(entries []OpEntry, current int64) *BoardState {
+    state := newBoardState(current)
+    for _, e := range entries {
+        var op gameOp
+        if json.Unmarshal(e.Op, &op) != nil || op.Type != opTypeMove || op.SessionId != current { continue }
+        if err := state.applyMove(op, e.Cursor, e.PeerId); err != nil {
+            pos := -1
+            if op.Position != nil { pos = *op.Position }
+            state.Rejected = append(state.Rejected, RejectedMove{
+                Move: Move{Id: op.Id, Position: pos, PlayerId: op.PlayerId, Timestamp: op.Timestamp, Cursor: e.Cursor},
+                Reason:   err.Error(),
+            })
+        }
+    }
+    return state
+}
+
+// validateOperation rejects tictactoe_move payloads of signer that would be
+// illegal against the board materialized from entries. Other op types pass
+// through.
+func validateOperation(entries []OpEntry, signer string, jsonData []byte) error {
+    var op gameOp
+    if err := json.Unmarshal(jsonData, &op); err != nil { return fmt.Errorf("json parse: %w", err) }
+    if op.Type != opTypeMove { return nil }
+    return checkMove(materializeBoard(entries), op, signer)
+}
+
+// checkMove validates a tictactoe_move signed by signer against b
+func checkMove(b *BoardState, op gameOp, signer string) error {
+    if op.PlayerId == "" { return fmt.Errorf("invalid move: %w: missing playerId", ErrInvalidArgument) }
+    if err := b.validateMove(op, signer); err != nil { return fmt.Errorf("invalid move: %w", err) }
+    return nil
+}
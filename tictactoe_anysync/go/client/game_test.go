@@ -0,0 +1,130 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "testing"
+)
+
+func moveOp(session int64, player string, pos int) []byte {
+    return []byte(fmt.Sprintf(`{"type":"tictactoe_move","id":"%s-%d","position":%d,"playerId":"%s","timestamp":1,"sessionId":%d}`, player, pos, pos, player, session))
+}
+
+func resetOp(session int64) []byte {
+    return []byte(fmt.Sprintf(`{"type":"tictactoe_reset","by":"a","sessionId":%d}`, session))
+}
+
+// opLog builds log entries in the given order with arrival cursors
+func opLog(ops ...[]byte) []OpEntry {
+    entries := make([]OpEntry, len(ops))
+    for i, op := range ops { entries[i] = OpEntry{Cursor: fmt.Sprintf("c-%03d", i+1), Op: op} }
+    return entries
+}
+
+func TestValidateOperation(t *testing.T) {
+    tests := []struct {
+        name string
+        log  []OpEntry
+        op   []byte
+        want error
+    }{
+        {"first move", nil, moveOp(1, "a", 4), nil},
+        {"second player", opLog(moveOp(1, "a", 4)), moveOp(1, "b", 0), nil},
+        {"same player twice", opLog(moveOp(1, "a", 4)), moveOp(1, "a", 0), ErrNotYourTurn},
+        {"out of turn after two", opLog(moveOp(1, "a", 4), moveOp(1, "b", 0)), moveOp(1, "b", 1), ErrNotYourTurn},
+        {"third player", opLog(moveOp(1, "a", 4), moveOp(1, "b", 0)), moveOp(1, "c", 1), ErrNoSeat},
+        {"occupied", opLog(moveOp(1, "a", 4)), moveOp(1, "b", 4), ErrOccupied},
+        {"out of range", nil, moveOp(1, "a", 9), ErrBadPosition},
+        {"stale session", opLog(resetOp(2)), moveOp(1, "a", 4), ErrStaleSession},
+        {"after reset", opLog(moveOp(1, "a", 4), resetOp(2)), moveOp(2, "a", 4), nil},
+        {"game over", opLog(moveOp(1, "a", 0), moveOp(1, "b", 3), moveOp(1, "a", 1), moveOp(1, "b", 4), moveOp(1, "a", 2)), moveOp(1, "b", 5), ErrGameOver},
+        {"missing player", nil, []byte(`{"type":"tictactoe_move","position":1,"sessionId":1}`), ErrInvalidArgument},
+        {"other op types", nil, []byte(`{"type":"player_register","playerId":"a"}`), nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := validateOperation(tt.log, "", tt.op)
+            if tt.want == nil && err != nil { t.Fatalf("unexpected error: %v", err) }
+            if tt.want != nil && !errors.Is(err, tt.want) { t.Fatalf("got %v, want %v", err, tt.want) }
+        })
+    }
+}
+
+func TestMaterializeBoardWinner(t *testing.T) {
+    b := materializeBoard(opLog(moveOp(1, "a", 0), moveOp(1, "b", 3), moveOp(1, "a", 1), moveOp(1, "b", 4), moveOp(1, "a", 2)))
+    if b.Winner != "a" || b.Turn != "" || b.Draw { t.Fatalf("winner %q turn %q draw %v", b.Winner, b.Turn, b.Draw) }
+    if got := b.Symbols[:3]; got[0] != "X" || got[1] != "X" || got[2] != "X" { t.Fatalf("symbols %v", b.Symbols) }
+    if b.Symbols[3] != "O" { t.Fatalf("symbols %v", b.Symbols) }
+    if len(b.Moves) != 5 || len(b.Rejected) != 0 { t.Fatalf("%d moves, %d rejected", len(b.Moves), len(b.Rejected)) }
+}
+
+func TestMaterializeBoardDraw(t *testing.T) {
+    // X O X / X O O / O X X
+    order := []struct {
+        p   string
+        pos int
+    }{{"a", 0}, {"b", 1}, {"a", 2}, {"b", 4}, {"a", 3}, {"b", 5}, {"a", 7}, {"b", 6}, {"a", 8}}
+    var ops [][]byte
+    for _, m := range order { ops = append(ops, moveOp(1, m.p, m.pos)) }
+    b := materializeBoard(opLog(ops...))
+    if !b.Draw || b.Winner != "" { t.Fatalf("draw %v winner %q", b.Draw, b.Winner) }
+}
+
+func TestMaterializeBoardTurnOrder(t *testing.T) {
+    b := materializeBoard(opLog(moveOp(1, "a", 0)))
+    // the second seat is still free, anyone but a may take it
+    if b.Turn != "" { t.Fatalf("turn %q with a free seat", b.Turn) }
+    b = materializeBoard(opLog(moveOp(1, "a", 0), moveOp(1, "b", 1)))
+    if b.Turn != "a" { t.Fatalf("turn %q, want a", b.Turn) }
+    if len(b.Players) != 2 || b.Players[0] != "a" || b.Players[1] != "b" { t.Fatalf("players %v", b.Players) }
+}
+
+func TestMaterializeBoardConcurrentMoves(t *testing.T) {
+    // both peers played cell 4 before seeing each other: the first in the log wins
+    b := materializeBoard(opLog(moveOp(1, "a", 0), moveOp(1, "b", 4), moveOp(1, "c", 4)))
+    if b.Board[4] != "b" { t.Fatalf("cell 4 = %q, want b", b.Board[4]) }
+    if len(b.Rejected) != 1 || b.Rejected[0].PlayerId != "c" || b.Rejected[0].Cursor != "c-003" { t.Fatalf("rejected %+v", b.Rejected) }
+}
+
+func TestMaterializeBoardReset(t *testing.T) {
+    b := materializeBoard(opLog(moveOp(1, "a", 0), moveOp(1, "b", 1), resetOp(2)))
+    if b.SessionId != 2 || len(b.Moves) != 0 || b.Board[0] != "" { t.Fatalf("session %d, %d moves", b.SessionId, len(b.Moves)) }
+    // late moves of the old session never reach the new board
+    b = materializeBoard(opLog(resetOp(2), moveOp(2, "b", 4), moveOp(1, "a", 0)))
+    if b.Board[0] != "" || b.Board[4] != "b" || len(b.Rejected) != 0 { t.Fatalf("board %v, rejected %+v", b.Board, b.Rejected) }
+    if b := materializeBoard(nil); b.SessionId != 1 { t.Fatalf("empty log session %d", b.SessionId) }
+}
+
+// signedLog is opLog with the signer of every entry
+func signedLog(signers []string, ops ...[]byte) []OpEntry {
+    entries := opLog(ops...)
+    for i := range entries { entries[i].PeerId = signers[i] }
+    return entries
+}
+
+func TestMaterializeSessionSeatOwners(t *testing.T) {
+    // bob writes a move with alice's playerId
+    entries := signedLog([]string{"alice", "bob", "bob"}, moveOp(1, "a", 0), moveOp(1, "b", 4), moveOp(1, "a", 8))
+    b := materializeSession(entries, 1)
+    if b.Board[8] != "" || len(b.Moves) != 2 { t.Fatalf("forged move applied: %v", b.Board) }
+    if len(b.Rejected) != 1 || b.Rejected[0].Reason != ErrNotSeatOwner.Error() { t.Fatalf("rejected %+v", b.Rejected) }
+    if b.Turn != "a" { t.Fatalf("turn %q, want a", b.Turn) }
+    // alice herself may, also from another device of the same identity
+    entries = append(entries, signedLog([]string{"alice"}, moveOp(1, "a", 8))...)
+    if b := materializeSession(entries, 1); b.Board[8] != "a" { t.Fatalf("owner's move rejected: %+v", b.Rejected) }
+    // entries without a signer are not checked
+    if b := materializeSession(opLog(moveOp(1, "a", 0), moveOp(1, "b", 4), moveOp(1, "a", 8)), 1); b.Board[8] != "a" { t.Fatal("unsigned move rejected") }
+}
+
+func TestCheckMoveSigner(t *testing.T) {
+    b := materializeSession(signedLog([]string{"alice", "bob"}, moveOp(1, "a", 0), moveOp(1, "b", 4)), 1)
+    var op gameOp
+    if err := json.Unmarshal(moveOp(1, "a", 8), &op); err != nil { t.Fatal(err) }
+    err := checkMove(b, op, "bob")
+    if !errors.Is(err, ErrNotSeatOwner) || ErrorCode(err) != CodeInvalidMove { t.Fatalf("bob playing a: %v", err) }
+    if err := checkMove(b, op, "alice"); err != nil { t.Fatalf("alice playing a: %v", err) }
+    // a new player takes the free seat with any identity
+    err = validateOperation(signedLog([]string{"alice"}, moveOp(1, "a", 0)), "carol", moveOp(1, "c", 4))
+    if err != nil { t.Fatalf("taking the free seat: %v", err) }
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strconv"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    acctsvc "github.com/anyproto/any-sync/accountservice"
+    "github.com/anyproto/any-sync/commonspace"
+    "github.com/anyproto/any-sync/commonspace/object/tree/objecttree"
+    "github.com/anyproto/any-sync/commonspace/object/tree/treestorage"
+)
+
+// Every game session is also an object tree of signed changes, one change per
+// move or reset. The tree id is derived from (space, session), so all peers
+// write into the same tree without coordinating who creates it. Trees give
+// causal order and history and are the only source of the board: the latest
+// session is the highest one whose tree is stored (sessions count up from 1),
+// its board is replayed from the tree, and each change is checked against the
+// identity that signed it. A move is validated against that board and written
+// to the tree before it goes to the KeyValue op log, which is only the live
+// feed (events, cursors); an op log entry that is lost after the tree write
+// leaves the board correct.
+
+const (
+    sessionTreeType = "tictactoe.session"
+    sessionDataType = "tictactoe.op"
+)
+
+// HistoryEntry is one change of a session tree in causal order; Timestamp is
+// the change time in unix seconds
+type HistoryEntry struct {
+    ChangeId  string          `json:"changeId"`
+    Identity  string          `json:"identity"`
+    Timestamp int64           `json:"timestamp"`
+    Op        json.RawMessage `json:"op"`
+}
+
+// spaceForTrees resolves open, non-demo spaces for the tree manager
+func (c *Client) spaceForTrees(spaceId string) (commonspace.Space, error) {
+    s, err := c.getSpace(spaceId)
+    if err != nil { return nil, err }
+    if s.demo() { return nil, fmt.Errorf("%w: demo space %s has no trees", ErrInvalidArgument, spaceId) }
+    return s.space, nil
+}
+
+func sessionKey(sessionId int64) string {
+    if sessionId <= 0 { sessionId = 1 }
+    return strconv.FormatInt(sessionId, 10)
+}
+
+// deriveSessionTree builds the root of the session's tree without storing it
+func deriveSessionTree(ctx context.Context, s *openSpace, sessionId int64) (treestorage.TreeStorageCreatePayload, error) {
+    create, err := s.space.TreeBuilder().DeriveTree(ctx, objecttree.ObjectTreeDerivePayload{
+        ChangeType:    sessionTreeType,
+        ChangePayload: []byte(sessionKey(sessionId)),
+        SpaceId:       s.id,
+        IsEncrypted:   true,
+    })
+    if err != nil { return create, fmt.Errorf("derive session tree: %w", err) }
+    return create, nil
+}
+
+// sessionTree returns the session's tree, creating it locally on first use
+func (c *Client) sessionTree(ctx context.Context, s *openSpace, sessionId int64) (objecttree.ObjectTree, error) {
+    create, err := deriveSessionTree(ctx, s, sessionId)
+    if err != nil { return nil, err }
+    err = c.trees.ValidateAndPutTree(ctx, s.id, create)
+    if err != nil && !errors.Is(err, treestorage.ErrTreeExists) { return nil, fmt.Errorf("put session tree: %w", err) }
+    return c.trees.GetTree(ctx, s.id, create.RootRawChange.Id)
+}
+
+// recordInSessionTree appends moves and resets to their session tree
+func (c *Client) recordInSessionTree(ctx context.Context, s *openSpace, jsonData []byte) error {
+    var op gameOp
+    if err := json.Unmarshal(jsonData, &op); err != nil { return err }
+    if op.Type != opTypeMove && op.Type != opTypeReset { return nil }
+    tree, err := c.sessionTree(ctx, s, op.SessionId)
+    if err != nil { return err }
+    keys := anyapp.MustComponent[acctsvc.Service](c.app).Account()
+    tree.Lock()
+    defer tree.Unlock()
+    _, err = tree.AddContent(ctx, objecttree.SignableChangeContent{
+        Data:        jsonData,
+        Key:         keys.SignKey,
+        IsEncrypted: true,
+        Timestamp:   op.Timestamp / 1000,
+        DataType:    sessionDataType,
+    })
+    return err
+}
+
+// sendWithTree is sendOperation for spaces with session trees. A failed tree
+// write fails the send and nothing reaches the op log.
+func (c *Client) sendWithTree(ctx context.Context, s *openSpace, peerId string, jsonData []byte) error {
+    s.sendMu.Lock()
+    defer s.sendMu.Unlock()
+    var op gameOp
+    if err := json.Unmarshal(jsonData, &op); err != nil { return fmt.Errorf("json parse: %w", err) }
+    if op.Type == opTypeMove {
+        board, err := c.latestBoard(ctx, s)
+        if err != nil { return err }
+        identity := anyapp.MustComponent[acctsvc.Service](c.app).Account().SignKey.GetPublic().Account()
+        if err := checkMove(board, op, identity); err != nil { return err }
+    }
+    if err := c.recordInSessionTree(ctx, s, jsonData); err != nil { return fmt.Errorf("session tree: %w", err) }
+    return s.appendLocked(ctx, peerId, jsonData)
+}
+
+// latestTreeSession is the highest session whose tree is stored, 1 when
+// there is none
+func latestTreeSession(ctx context.Context, s *openSpace) (int64, error) {
+    stored := make(map[string]struct{})
+    for _, id := range s.space.StoredIds() { stored[id] = struct{}{} }
+    var session int64 = 1
+    for {
+        next, err := deriveSessionTree(ctx, s, session+1)
+        if err != nil { return 0, err }
+        if _, ok := stored[next.RootRawChange.Id]; !ok { return session, nil }
+        session++
+    }
+}
+
+// latestBoard replays the tree of the latest session; seats belong to the
+// identities that signed the changes taking them
+func (c *Client) latestBoard(ctx context.Context, s *openSpace) (*BoardState, error) {
+    session, err := latestTreeSession(ctx, s)
+    if err != nil { return nil, err }
+    history, err := c.sessionHistory(ctx, s, session)
+    if err != nil { return nil, err }
+    changes := make([]OpEntry, len(history))
+    for i, h := range history { changes[i] = OpEntry{Cursor: h.ChangeId, PeerId: h.Identity, Op: h.Op} }
+    return materializeSession(changes, session), nil
+}
+
+// SessionHistory returns the moves and resets of a game session from its
+// object tree, in causal order
+func (c *Client) SessionHistory(ctx context.Context, spaceId string, sessionId int64) ([]HistoryEntry, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    if !c.started || c.trees == nil { return nil, ErrNotStarted }
+    s, err := c.getSpace(spaceId)
+    if err != nil { return nil, err }
+    if s.demo() { return nil, fmt.Errorf("%w: demo space %s has no trees", ErrInvalidArgument, spaceId) }
+    return c.sessionHistory(ctx, s, sessionId)
+}
+
+func (c *Client) sessionHistory(ctx context.Context, s *openSpace, sessionId int64) ([]HistoryEntry, error) {
+    tree, err := c.sessionTree(ctx, s, sessionId)
+    if err != nil { return nil, err }
+
+    out := []HistoryEntry{}
+    tree.Lock()
+    defer tree.Unlock()
+    err = tree.IterateRoot(
+        func(ch *objecttree.Change, decrypted []byte) (any, error) { return decrypted, nil },
+        func(ch *objecttree.Change) bool {
+            data, ok := ch.Model.([]byte)
+            if ch.Id == tree.Id() || !ok || ch.DataType != sessionDataType { return true }
+            e := HistoryEntry{ChangeId: ch.Id, Timestamp: ch.Timestamp, Op: json.RawMessage(data)}
+            if ch.Identity != nil { e.Identity = ch.Identity.Account() }
+            out = append(out, e)
+            return true
+        })
+    if err != nil { return nil, fmt.Errorf("iterate session tree: %w", err) }
+    return out, nil
+}
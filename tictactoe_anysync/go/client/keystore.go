@@ -0,0 +1,237 @@
+package client
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    acctsvc "github.com/anyproto/any-sync/accountservice"
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+    "github.com/anyproto/any-sync/util/crypto"
+    "golang.org/x/crypto/scrypt"
+)
+
+// On-disk account keystore: the mnemonic (identity) and a per-install peer key
+// are sealed with AES-256-GCM under a key derived from the user's passphrase
+// with scrypt. Only ciphertext ever touches the disk. Keystores whose scrypt
+// parameters are below the ones written here are refused, so a tampered file
+// cannot make the passphrase cheap to brute force, and an existing keystore is
+// only replaced with its passphrase or an explicit overwrite. A new keystore
+// is written to a temp file of its own and hard-linked into place, so two
+// concurrent creates cannot both succeed.
+
+const (
+    keystoreFile    = "account.json"
+    keystoreVersion = 1
+    scryptN         = 1 << 15
+    scryptR         = 8
+    scryptP         = 1
+)
+
+// Keystore errors returned by the account methods
+var (
+    ErrKeystoreMissing = errors.New("account keystore not found")
+    ErrKeystoreExists  = errors.New("account keystore already exists")
+    ErrBadPassphrase   = errors.New("wrong passphrase or corrupted keystore")
+    ErrKeystoreCorrupt = errors.New("account keystore is corrupted")
+)
+
+type keystoreFileData struct {
+    Version    int    `json:"version"`
+    Kdf        string `json:"kdf"`
+    N          int    `json:"n"`
+    R          int    `json:"r"`
+    P          int    `json:"p"`
+    Salt       []byte `json:"salt"`
+    Nonce      []byte `json:"nonce"`
+    Ciphertext []byte `json:"ciphertext"`
+}
+
+type keystoreSecret struct {
+    Mnemonic string `json:"mnemonic"`
+    PeerKey  []byte `json:"peerKey"`
+}
+
+// keystoreAccount is the accountservice.Service registered in the app
+type keystoreAccount struct {
+    keys *accountdata.AccountKeys
+}
+
+func (a *keystoreAccount) Init(*anyapp.App) error { return nil }
+func (a *keystoreAccount) Name() string { return acctsvc.CName }
+func (a *keystoreAccount) Account() *accountdata.AccountKeys { return a.keys }
+
+func keystorePath(root string) string { return filepath.Join(root, keystoreFile) }
+
+func keystoreExists(root string) bool {
+    _, err := os.Stat(keystorePath(root))
+    return err == nil
+}
+
+// accountFromSecret derives the signing identity from the mnemonic and uses
+// the stored device key as the peer key, so one mnemonic can run on several
+// devices without peer id clashes.
+func accountFromSecret(sec *keystoreSecret) (*keystoreAccount, error) {
+    derived, err := crypto.Mnemonic(sec.Mnemonic).DeriveKeys(0)
+    if err != nil { return nil, fmt.Errorf("derive keys: %w", err) }
+    peerKey, err := crypto.UnmarshalEd25519PrivateKeyProto(sec.PeerKey)
+    if err != nil { return nil, fmt.Errorf("peer key: %w", err) }
+    peerId, err := crypto.IdFromSigningPubKey(peerKey.GetPublic())
+    if err != nil { return nil, err }
+    return &keystoreAccount{keys: &accountdata.AccountKeys{
+        PeerKey: peerKey,
+        SignKey: derived.Identity,
+        PeerId:  peerId.String(),
+    }}, nil
+}
+
+func newKeystoreSecret(mnemonic string) (*keystoreSecret, error) {
+    mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+    if _, err := crypto.Mnemonic(mnemonic).DeriveKeys(0); err != nil { return nil, fmt.Errorf("invalid mnemonic: %w: %w", ErrInvalidArgument, err) }
+    peerKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+    if err != nil { return nil, err }
+    raw, err := peerKey.Marshall()
+    if err != nil { return nil, err }
+    return &keystoreSecret{Mnemonic: mnemonic, PeerKey: raw}, nil
+}
+
+// keystoreTempPattern names the temp files sealKeystore writes
+const keystoreTempPattern = keystoreFile + ".*.tmp"
+
+// sealKeystore writes the keystore. Unless replace is set it never overwrites
+// one and returns ErrKeystoreExists when a keystore appeared meanwhile.
+func sealKeystore(root string, sec *keystoreSecret, passphrase string, replace bool) error {
+    plain, err := json.Marshal(sec)
+    if err != nil { return err }
+    salt := make([]byte, 32)
+    if _, err := rand.Read(salt); err != nil { return err }
+    gcm, err := keystoreCipher(passphrase, salt, scryptN, scryptR, scryptP)
+    if err != nil { return err }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := rand.Read(nonce); err != nil { return err }
+    data := keystoreFileData{
+        Version: keystoreVersion, Kdf: "scrypt", N: scryptN, R: scryptR, P: scryptP,
+        Salt: salt, Nonce: nonce, Ciphertext: gcm.Seal(nil, nonce, plain, nil),
+    }
+    b, err := json.MarshalIndent(data, "", "  ")
+    if err != nil { return err }
+    if err := os.MkdirAll(root, 0o700); err != nil { return err }
+    // write-then-rename so a crash never leaves a truncated keystore behind;
+    // CreateTemp opens O_EXCL with mode 0600
+    f, err := os.CreateTemp(root, keystoreTempPattern)
+    if err != nil { return err }
+    tmp := f.Name()
+    defer os.Remove(tmp)
+    _, err = f.Write(b)
+    if err == nil { err = f.Sync() }
+    if cerr := f.Close(); err == nil { err = cerr }
+    if err != nil { return err }
+    if replace { return os.Rename(tmp, keystorePath(root)) }
+    // link fails instead of overwriting a keystore created since the check
+    if err := os.Link(tmp, keystorePath(root)); err != nil {
+        if errors.Is(err, os.ErrExist) { return ErrKeystoreExists }
+        return err
+    }
+    return nil
+}
+
+func openKeystore(root string, passphrase string) (*keystoreSecret, error) {
+    b, err := os.ReadFile(keystorePath(root))
+    if errors.Is(err, os.ErrNotExist) { return nil, ErrKeystoreMissing }
+    if err != nil { return nil, err }
+    var data keystoreFileData
+    if err := json.Unmarshal(b, &data); err != nil { return nil, fmt.Errorf("%w: %w", ErrKeystoreCorrupt, err) }
+    if data.Version != keystoreVersion || data.Kdf != "scrypt" {
+        return nil, fmt.Errorf("unsupported keystore version %d (%s)", data.Version, data.Kdf)
+    }
+    if data.N < scryptN || data.R < scryptR || data.P < scryptP {
+        return nil, fmt.Errorf("%w: scrypt parameters N=%d r=%d p=%d are below the minimum", ErrKeystoreCorrupt, data.N, data.R, data.P)
+    }
+    gcm, err := keystoreCipher(passphrase, data.Salt, data.N, data.R, data.P)
+    if err != nil { return nil, fmt.Errorf("%w: %w", ErrKeystoreCorrupt, err) }
+    if len(data.Nonce) != gcm.NonceSize() { return nil, fmt.Errorf("%w: nonce of %d bytes", ErrKeystoreCorrupt, len(data.Nonce)) }
+    plain, err := gcm.Open(nil, data.Nonce, data.Ciphertext, nil)
+    if err != nil { return nil, ErrBadPassphrase }
+    var sec keystoreSecret
+    if err := json.Unmarshal(plain, &sec); err != nil { return nil, ErrBadPassphrase }
+    return &sec, nil
+}
+
+func keystoreCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+    key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+    if err != nil { return nil, err }
+    block, err := aes.NewCipher(key)
+    if err != nil { return nil, err }
+    return cipher.NewGCM(block)
+}
+
+// ---------------- per-client account -----------------
+
+func (c *Client) setAccount(sec *keystoreSecret) error {
+    acc, err := accountFromSecret(sec)
+    if err != nil { return err }
+    c.accountMu.Lock()
+    c.account = acc
+    c.accountMu.Unlock()
+    return nil
+}
+
+func (c *Client) unlockedAccount() *keystoreAccount {
+    c.accountMu.Lock()
+    defer c.accountMu.Unlock()
+    return c.account
+}
+
+func checkPassphrase(passphrase string) error {
+    if passphrase == "" { return fmt.Errorf("%w: empty passphrase", ErrInvalidArgument) }
+    return nil
+}
+
+// CreateAccount generates a fresh mnemonic, stores it and unlocks it
+func (c *Client) CreateAccount(passphrase string) (string, error) {
+    if err := checkPassphrase(passphrase); err != nil { return "", err }
+    if keystoreExists(c.root) { return "", ErrKeystoreExists }
+    mnemonic, err := crypto.NewMnemonicGenerator().WithWordCount(12)
+    if err != nil { return "", err }
+    sec, err := newKeystoreSecret(string(mnemonic))
+    if err != nil { return "", err }
+    if err := sealKeystore(c.root, sec, passphrase, false); err != nil { return "", err }
+    return sec.Mnemonic, c.setAccount(sec)
+}
+
+// ImportMnemonic stores the given mnemonic under passphrase and unlocks it.
+// An existing keystore is only replaced when oldPassphrase opens it or
+// overwrite is set; otherwise its identity would be lost without a check.
+func (c *Client) ImportMnemonic(mnemonic, passphrase, oldPassphrase string, overwrite bool) error {
+    if err := checkPassphrase(passphrase); err != nil { return err }
+    sec, err := newKeystoreSecret(mnemonic)
+    if err != nil { return err }
+    exists := keystoreExists(c.root)
+    if exists && !overwrite {
+        if _, err := openKeystore(c.root, oldPassphrase); err != nil { return fmt.Errorf("replace existing keystore: %w", err) }
+    }
+    if err := sealKeystore(c.root, sec, passphrase, exists || overwrite); err != nil { return err }
+    return c.setAccount(sec)
+}
+
+// UnlockAccount decrypts the keystore; the account is used by the next Start.
+// It returns ErrKeystoreMissing when no keystore exists yet.
+func (c *Client) UnlockAccount(passphrase string) error {
+    sec, err := openKeystore(c.root, passphrase)
+    if err != nil { return err }
+    return c.setAccount(sec)
+}
+
+// ExportMnemonic returns the stored mnemonic after checking the passphrase
+func (c *Client) ExportMnemonic(passphrase string) (string, error) {
+    sec, err := openKeystore(c.root, passphrase)
+    if err != nil { return "", err }
+    return sec.Mnemonic, nil
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+)
+
+// editKeystore rewrites fields of the stored keystore file
+func editKeystore(t *testing.T, root string, edit func(d *keystoreFileData)) {
+    t.Helper()
+    b, err := os.ReadFile(keystorePath(root))
+    if err != nil { t.Fatal(err) }
+    var d keystoreFileData
+    if err := json.Unmarshal(b, &d); err != nil { t.Fatal(err) }
+    edit(&d)
+    if b, err = json.Marshal(d); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(keystorePath(root), b, 0o600); err != nil { t.Fatal(err) }
+}
+
+func TestKeystoreUnlock(t *testing.T) {
+    root := t.TempDir()
+    c := &Client{root: root}
+    if err := c.UnlockAccount("pass"); !errors.Is(err, ErrKeystoreMissing) { t.Fatalf("unlock before create: %v", err) }
+    mnemonic, err := c.CreateAccount("pass")
+    if err != nil { t.Fatal(err) }
+    if p := perm(t, keystorePath(root)); p != 0o600 { t.Fatalf("keystore is %#o", p) }
+
+    // a restart unlocks the same identity
+    again := &Client{root: root}
+    if err := again.UnlockAccount("pass"); err != nil { t.Fatal(err) }
+    a, b := c.unlockedAccount().keys, again.unlockedAccount().keys
+    if !a.SignKey.GetPublic().Equals(b.SignKey.GetPublic()) || a.PeerId != b.PeerId { t.Fatal("unlocked another identity") }
+    if got, err := again.ExportMnemonic("pass"); err != nil || got != mnemonic { t.Fatalf("export %q, %v", got, err) }
+
+    err = again.UnlockAccount("wrong")
+    if !errors.Is(err, ErrBadPassphrase) || ErrorCode(err) != CodeBadPassphrase { t.Fatalf("wrong passphrase: %v", err) }
+    if _, err := again.ExportMnemonic("wrong"); !errors.Is(err, ErrBadPassphrase) { t.Fatalf("export with a wrong passphrase: %v", err) }
+}
+
+func TestKeystorePassphraseRequired(t *testing.T) {
+    c := &Client{root: t.TempDir()}
+    if _, err := c.CreateAccount(""); ErrorCode(err) != CodeInvalidArgument { t.Fatalf("create: %v", err) }
+    if exists(keystorePath(c.root)) { t.Fatal("keystore written without a passphrase") }
+    if _, err := c.CreateAccount("pass"); err != nil { t.Fatal(err) }
+    if err := c.ImportMnemonic("abandon", "", "pass", true); ErrorCode(err) != CodeInvalidArgument { t.Fatalf("import: %v", err) }
+}
+
+func TestKeystoreCorrupt(t *testing.T) {
+    tests := []struct {
+        name string
+        edit func(d *keystoreFileData)
+    }{
+        {"weak N", func(d *keystoreFileData) { d.N = 1 << 10 }},
+        {"weak r", func(d *keystoreFileData) { d.R = 1 }},
+        {"N not a power of two", func(d *keystoreFileData) { d.N = scryptN + 1 }},
+        {"short nonce", func(d *keystoreFileData) { d.Nonce = d.Nonce[:4] }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c := &Client{root: t.TempDir()}
+            if _, err := c.CreateAccount("pass"); err != nil { t.Fatal(err) }
+            editKeystore(t, c.root, tt.edit)
+            // even the right passphrase is not a passphrase error
+            err := c.UnlockAccount("pass")
+            if !errors.Is(err, ErrKeystoreCorrupt) || errors.Is(err, ErrBadPassphrase) { t.Fatalf("unlock: %v", err) }
+            if ErrorCode(err) != CodeKeystoreCorrupt { t.Fatalf("code %s", ErrorCode(err)) }
+        })
+    }
+    c := &Client{root: t.TempDir()}
+    if err := os.WriteFile(keystorePath(c.root), []byte("{"), 0o600); err != nil { t.Fatal(err) }
+    if err := c.UnlockAccount("pass"); ErrorCode(err) != CodeKeystoreCorrupt { t.Fatalf("unparsable keystore: %v", err) }
+}
+
+func TestKeystoreCreateOnce(t *testing.T) {
+    root := t.TempDir()
+    const n = 6
+    mnemonics := make([]string, n)
+    errs := make([]error, n)
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            mnemonics[i], errs[i] = (&Client{root: root}).CreateAccount("pass")
+        }(i)
+    }
+    wg.Wait()
+    winner := ""
+    for i, err := range errs {
+        switch {
+        case err == nil && winner == "":
+            winner = mnemonics[i]
+        case err == nil:
+            t.Fatal("two creates succeeded")
+        case !errors.Is(err, ErrKeystoreExists):
+            t.Fatalf("create: %v", err)
+        }
+    }
+    if winner == "" { t.Fatal("no create succeeded") }
+    if got, err := (&Client{root: root}).ExportMnemonic("pass"); err != nil || got != winner { t.Fatal("stored keystore is not the one returned") }
+    if temps, _ := filepath.Glob(filepath.Join(root, keystoreTempPattern)); len(temps) != 0 { t.Fatalf("temp files left: %v", temps) }
+}
+
+func TestKeystoreImportReplace(t *testing.T) {
+    c := &Client{root: t.TempDir()}
+    first, err := c.CreateAccount("old")
+    if err != nil { t.Fatal(err) }
+    other, err := (&Client{root: t.TempDir()}).CreateAccount("x")
+    if err != nil { t.Fatal(err) }
+    if err := c.ImportMnemonic(other, "new", "wrong", false); !errors.Is(err, ErrBadPassphrase) { t.Fatalf("replace with a wrong passphrase: %v", err) }
+    if got, _ := c.ExportMnemonic("old"); got != first { t.Fatal("keystore replaced without its passphrase") }
+    if err := c.ImportMnemonic(other, "new", "old", false); err != nil { t.Fatal(err) }
+    if got, _ := c.ExportMnemonic("new"); got != other { t.Fatal("import did not replace the keystore") }
+    if err := c.ImportMnemonic(first, "third", "", true); err != nil { t.Fatalf("overwrite: %v", err) }
+    if got, _ := c.ExportMnemonic("third"); got != first { t.Fatal("overwrite did not replace the keystore") }
+}
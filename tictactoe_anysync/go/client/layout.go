@@ -0,0 +1,241 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// The storage root carries layout.json with the version of its on-disk
+// layout. New upgrades older layouts one version at a time before anything
+// else touches the root, recording each version as it is reached so an
+// interrupted upgrade resumes where it stopped, and refuses layouts newer
+// than this build. A step describes its changes and only makes them when
+// asked, so the same code backs the dry run. Roots from before the manifest
+// are version 0. Sealing plaintext stores is not a layout step: it needs the
+// account key and happens when the storage provider starts (storecrypt.go).
+
+const (
+    layoutFile = "layout.json"
+    // LayoutVersion is the layout this build reads and writes
+    LayoutVersion = 1
+)
+
+// ErrLayoutUnsupported is returned for a storage root written by a newer build
+var ErrLayoutUnsupported = errors.New("storage layout is newer than this build")
+
+// ErrLayoutPending is returned when starting a LayoutDryRun client whose
+// layout migrations have not been applied with MigrateLayout
+var ErrLayoutPending = errors.New("storage layout migrations are pending")
+
+type layoutManifest struct {
+    Version   int   `json:"version"`
+    UpdatedMs int64 `json:"updatedMs"`
+}
+
+// LayoutStep is one migration of a LayoutReport with the changes it made, or
+// would make in a dry run
+type LayoutStep struct {
+    From    int      `json:"from"`
+    To      int      `json:"to"`
+    Name    string   `json:"name"`
+    Changes []string `json:"changes"`
+}
+
+// LayoutReport describes a storage root: the version found on disk, the
+// migrations to the current version and what verification found wrong
+type LayoutReport struct {
+    Root     string       `json:"root"`
+    Version  int          `json:"version"`
+    Target   int          `json:"target"`
+    DryRun   bool         `json:"dryRun"`
+    Steps    []LayoutStep `json:"steps"`
+    Problems []string     `json:"problems"` // not fixed by any migration
+}
+
+// layoutDirs are the directories a layout covers; spaces is empty for the
+// memory backend
+type layoutDirs struct {
+    root   string
+    spaces string
+}
+
+type layoutMigration struct {
+    name string
+    run  func(d layoutDirs, apply bool) ([]string, error)
+}
+
+// layoutMigrations[v] upgrades version v to v+1; append only
+var layoutMigrations = []layoutMigration{
+    {name: "private space directories, drop leftover temp files", run: migrateLayoutV1},
+}
+
+func (c *Client) layoutDirs() layoutDirs {
+    d := layoutDirs{root: c.root}
+    if c.storageOpts.Backend != StorageMemory { d.spaces = c.spacesRoot() }
+    return d
+}
+
+// CheckLayout reports the migrations the storage root needs and verifies it,
+// without changing anything
+func (c *Client) CheckLayout() (LayoutReport, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    return migrateLayout(c.layoutDirs(), false)
+}
+
+// MigrateLayout upgrades the storage root to LayoutVersion; for clients
+// created with LayoutDryRun, which cannot start until it succeeds. The client
+// must not be started.
+func (c *Client) MigrateLayout() (LayoutReport, error) {
+    c.lifecycleMu.Lock()
+    defer c.lifecycleMu.Unlock()
+    if c.started { return LayoutReport{Root: c.root, Target: LayoutVersion}, fmt.Errorf("%w: shut the client down before migrating its layout", ErrInvalidArgument) }
+    rep, err := migrateLayout(c.layoutDirs(), true)
+    rep.log()
+    if err != nil { return rep, err }
+    c.layoutPending = false
+    return rep, nil
+}
+
+// layoutReady fails while a dry run left migrations pending. Callers hold
+// lifecycleMu.
+func (c *Client) layoutReady() error {
+    if c.layoutPending { return fmt.Errorf("%s: %w, call MigrateLayout first", c.root, ErrLayoutPending) }
+    return nil
+}
+
+// migrateLayout runs the pending migrations, or only describes them unless
+// apply is set, then verifies the layout
+func migrateLayout(d layoutDirs, apply bool) (LayoutReport, error) {
+    rep := LayoutReport{Root: d.root, Target: LayoutVersion, DryRun: !apply}
+    v, err := readLayout(d.root)
+    if err != nil { return rep, err }
+    rep.Version = v
+    if v > LayoutVersion { return rep, fmt.Errorf("%s has layout %d, this build knows %d: %w", d.root, v, LayoutVersion, ErrLayoutUnsupported) }
+    for ; v < LayoutVersion; v++ {
+        m := layoutMigrations[v]
+        changes, err := m.run(d, apply)
+        rep.Steps = append(rep.Steps, LayoutStep{From: v, To: v + 1, Name: m.name, Changes: changes})
+        if err != nil { return rep, fmt.Errorf("layout migration %d to %d: %w", v, v+1, err) }
+        if apply {
+            if err := writeLayout(d.root, v+1); err != nil { return rep, err }
+        }
+    }
+    rep.Problems = verifyLayout(d)
+    return rep, nil
+}
+
+func (r LayoutReport) log() {
+    verb := "migrated"
+    if r.DryRun { verb = "would migrate" }
+    for _, s := range r.Steps {
+        log.Printf("Storage layout %s: %s %d -> %d (%s), %d changes", r.Root, verb, s.From, s.To, s.Name, len(s.Changes))
+        for _, ch := range s.Changes { log.Printf("  %s", ch) }
+    }
+    for _, p := range r.Problems { log.Printf("Storage layout %s: %s", r.Root, p) }
+}
+
+// readLayout returns the layout version of root; 0 without a manifest
+func readLayout(root string) (int, error) {
+    b, err := os.ReadFile(filepath.Join(root, layoutFile))
+    if errors.Is(err, os.ErrNotExist) { return 0, nil }
+    if err != nil { return 0, err }
+    var m layoutManifest
+    if err := json.Unmarshal(b, &m); err != nil { return 0, fmt.Errorf("%s: %w", layoutFile, err) }
+    return m.Version, nil
+}
+
+func writeLayout(root string, version int) error {
+    b, err := json.MarshalIndent(layoutManifest{Version: version, UpdatedMs: time.Now().UnixMilli()}, "", "  ")
+    if err != nil { return err }
+    path := filepath.Join(root, layoutFile)
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, b, 0o600); err != nil { return err }
+    return os.Rename(tmp, path)
+}
+
+// tempFiles lists the temp files interrupted atomic writes of this code
+// leave behind: only the names it writes, in the directories it writes them
+// to, so files of other programs sharing the directories are left alone
+func (d layoutDirs) tempFiles() ([]string, error) {
+    var temps []string
+    match := func(dir string, patterns ...string) error {
+        entries, err := os.ReadDir(dir)
+        if errors.Is(err, os.ErrNotExist) { return nil }
+        if err != nil { return err }
+        for _, e := range entries {
+            if e.IsDir() { continue }
+            for _, p := range patterns {
+                if ok, _ := filepath.Match(p, e.Name()); ok { temps = append(temps, filepath.Join(dir, e.Name())); break }
+            }
+        }
+        return nil
+    }
+    // keystoreFile.tmp is the fixed temp name of builds before keystoreTempPattern
+    if err := match(d.root, layoutFile+".tmp", keystoreFile+".tmp", keystoreTempPattern); err != nil { return temps, err }
+    if err := match(filepath.Join(d.root, nodeConfDir), "*.yml.tmp"); err != nil { return temps, err }
+    for _, dir := range d.spaceDirs() {
+        if err := match(dir, sealedFile+".tmp"); err != nil { return temps, err }
+    }
+    return temps, nil
+}
+
+// spaceDirs lists the directories of the spaces root; none for the memory
+// backend
+func (d layoutDirs) spaceDirs() []string {
+    if d.spaces == "" { return nil }
+    entries, _ := os.ReadDir(d.spaces)
+    var dirs []string
+    for _, e := range entries {
+        if e.IsDir() { dirs = append(dirs, filepath.Join(d.spaces, e.Name())) }
+    }
+    return dirs
+}
+
+// migrateLayoutV1 makes the spaces root and every space directory 0700 (they
+// used to be created 0755) and removes the temp files left by interrupted
+// atomic writes
+func migrateLayoutV1(d layoutDirs, apply bool) ([]string, error) {
+    temps, err := d.tempFiles()
+    if err != nil { return nil, err }
+    var changes []string
+    for _, path := range temps {
+        changes = append(changes, "remove "+path)
+        if apply {
+            if err := os.Remove(path); err != nil { return changes, err }
+        }
+    }
+    if d.spaces == "" { return changes, nil }
+    for _, dir := range append([]string{d.spaces}, d.spaceDirs()...) {
+        info, err := os.Lstat(dir)
+        if errors.Is(err, os.ErrNotExist) { continue }
+        if err != nil { return changes, err }
+        if perm := info.Mode().Perm(); perm != 0o700 {
+            changes = append(changes, fmt.Sprintf("chmod 0700 %s (was %#o)", dir, perm))
+            if apply {
+                if err := os.Chmod(dir, 0o700); err != nil { return changes, err }
+            }
+        }
+    }
+    return changes, nil
+}
+
+// verifyLayout reports entries of the spaces root that are not space stores
+func verifyLayout(d layoutDirs) []string {
+    if d.spaces == "" { return nil }
+    entries, err := os.ReadDir(d.spaces)
+    if errors.Is(err, os.ErrNotExist) { return nil }
+    if err != nil { return []string{fmt.Sprintf("read %s: %v", d.spaces, err)} }
+    var problems []string
+    for _, e := range entries {
+        path := filepath.Join(d.spaces, e.Name())
+        if !e.IsDir() { problems = append(problems, "unexpected file "+path); continue }
+        if !hasStore(path) { problems = append(problems, "space directory without a store: "+path) }
+    }
+    return problems
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// oldRoot builds a version 0 storage root: no manifest, 0755 directories and
+// leftover temp files of interrupted writes
+func oldRoot(t *testing.T) layoutDirs {
+    t.Helper()
+    root := t.TempDir()
+    d := layoutDirs{root: root, spaces: filepath.Join(root, "spaces")}
+    space := filepath.Join(d.spaces, "space1")
+    if err := os.MkdirAll(space, 0o755); err != nil { t.Fatal(err) }
+    for _, dir := range []string{d.spaces, space} {
+        if err := os.Chmod(dir, 0o755); err != nil { t.Fatal(err) }
+    }
+    for _, f := range []string{filepath.Join(space, storeFile), filepath.Join(space, sealedFile+".tmp"), filepath.Join(root, keystoreFile+".tmp")} {
+        if err := os.WriteFile(f, []byte("x"), 0o600); err != nil { t.Fatal(err) }
+    }
+    return d
+}
+
+func perm(t *testing.T, path string) os.FileMode {
+    t.Helper()
+    info, err := os.Stat(path)
+    if err != nil { t.Fatal(err) }
+    return info.Mode().Perm()
+}
+
+func exists(path string) bool {
+    _, err := os.Stat(path)
+    return err == nil
+}
+
+func TestMigrateLayoutV1(t *testing.T) {
+    d := oldRoot(t)
+    rep, err := migrateLayout(d, true)
+    if err != nil { t.Fatal(err) }
+    if rep.Version != 0 || rep.DryRun || len(rep.Steps) != 1 { t.Fatalf("report %+v", rep) }
+    if n := len(rep.Steps[0].Changes); n != 4 { t.Fatalf("%d changes: %v", n, rep.Steps[0].Changes) }
+    for _, dir := range []string{d.spaces, filepath.Join(d.spaces, "space1")} {
+        if p := perm(t, dir); p != 0o700 { t.Fatalf("%s is %#o", dir, p) }
+    }
+    if exists(filepath.Join(d.spaces, "space1", sealedFile+".tmp")) || exists(filepath.Join(d.root, keystoreFile+".tmp")) { t.Fatal("temp files left") }
+    if !exists(filepath.Join(d.spaces, "space1", storeFile)) { t.Fatal("store removed") }
+    if v, err := readLayout(d.root); err != nil || v != LayoutVersion { t.Fatalf("layout %d, %v", v, err) }
+    if len(rep.Problems) != 0 { t.Fatalf("problems %v", rep.Problems) }
+
+    // a current root has nothing left to do
+    rep, err = migrateLayout(d, true)
+    if err != nil || rep.Version != LayoutVersion || len(rep.Steps) != 0 { t.Fatalf("second run %+v, %v", rep, err) }
+}
+
+func TestMigrateLayoutDryRun(t *testing.T) {
+    d := oldRoot(t)
+    for i := 0; i < 2; i++ {
+        rep, err := migrateLayout(d, false)
+        if err != nil { t.Fatal(err) }
+        if !rep.DryRun || rep.Version != 0 || len(rep.Steps) != 1 || len(rep.Steps[0].Changes) != 4 { t.Fatalf("run %d: report %+v", i, rep) }
+    }
+    if p := perm(t, filepath.Join(d.spaces, "space1")); p != 0o755 { t.Fatalf("space dir changed to %#o", p) }
+    if !exists(filepath.Join(d.root, keystoreFile+".tmp")) { t.Fatal("temp file removed") }
+    if exists(filepath.Join(d.root, layoutFile)) { t.Fatal("manifest written") }
+}
+
+func TestMigrateLayoutV1TempFiles(t *testing.T) {
+    d := oldRoot(t)
+    if err := os.MkdirAll(filepath.Join(d.root, nodeConfDir), 0o700); err != nil { t.Fatal(err) }
+    ours := []string{
+        filepath.Join(d.root, layoutFile+".tmp"),
+        filepath.Join(d.root, keystoreFile+".123.tmp"),
+        filepath.Join(d.root, nodeConfDir, "net.yml.tmp"),
+    }
+    // temp files of other programs sharing the directories
+    foreign := []string{
+        filepath.Join(d.root, "notes.tmp"),
+        filepath.Join(d.root, nodeConfDir, "editor.tmp"),
+        filepath.Join(d.spaces, "space1", "other.tmp"),
+    }
+    for _, f := range append(ours, foreign...) {
+        if err := os.WriteFile(f, []byte("x"), 0o600); err != nil { t.Fatal(err) }
+    }
+    rep, err := migrateLayout(d, true)
+    if err != nil { t.Fatal(err) }
+    if n := len(rep.Steps[0].Changes); n != 4+len(ours) { t.Fatalf("%d changes: %v", n, rep.Steps[0].Changes) }
+    for _, f := range ours {
+        if exists(f) { t.Errorf("%s left", f) }
+    }
+    for _, f := range foreign {
+        if !exists(f) { t.Errorf("%s removed", f) }
+    }
+}
+
+func TestMigrateLayoutNewer(t *testing.T) {
+    root := t.TempDir()
+    if err := writeLayout(root, LayoutVersion+1); err != nil { t.Fatal(err) }
+    rep, err := migrateLayout(layoutDirs{root: root}, true)
+    if !errors.Is(err, ErrLayoutUnsupported) { t.Fatalf("got %v", err) }
+    if rep.Version != LayoutVersion+1 || len(rep.Steps) != 0 { t.Fatalf("report %+v", rep) }
+    if ErrorCode(err) != CodeLayout { t.Fatalf("code %s", ErrorCode(err)) }
+}
+
+func TestVerifyLayout(t *testing.T) {
+    root := t.TempDir()
+    d := layoutDirs{root: root, spaces: filepath.Join(root, "spaces")}
+    for _, dir := range []string{"sealed", "plain", "empty"} {
+        if err := os.MkdirAll(filepath.Join(d.spaces, dir), 0o700); err != nil { t.Fatal(err) }
+    }
+    for _, f := range []string{filepath.Join("sealed", sealedFile), filepath.Join("plain", storeFile), "stray"} {
+        if err := os.WriteFile(filepath.Join(d.spaces, f), []byte("x"), 0o600); err != nil { t.Fatal(err) }
+    }
+    problems := verifyLayout(d)
+    if len(problems) != 2 { t.Fatalf("problems %v", problems) }
+    if verifyLayout(layoutDirs{root: root}) != nil { t.Fatal("memory backend verified spaces") }
+}
+
+func TestLayoutDryRunBlocksStart(t *testing.T) {
+    d := oldRoot(t)
+    c, err := New(Options{StorageRoot: d.root, Demo: true, LayoutDryRun: true})
+    if err != nil { t.Fatal(err) }
+    if err := c.Start("127.0.0.1", 1004, "net"); !errors.Is(err, ErrLayoutPending) { t.Fatalf("start: %v", err) }
+    err = c.Reconfigure(context.Background(), "127.0.0.1", 1004, "net")
+    if !errors.Is(err, ErrLayoutPending) || ErrorCode(err) != CodeLayoutPending { t.Fatalf("reconfigure: %v (%s)", err, ErrorCode(err)) }
+    if c.Started() { t.Fatal("started with pending layout") }
+    rep, err := c.MigrateLayout()
+    if err != nil || len(rep.Steps) != 1 { t.Fatalf("migrate %+v, %v", rep, err) }
+    if err := c.Start("127.0.0.1", 1004, "net"); err != nil { t.Fatalf("start after migrate: %v", err) }
+    if err := c.Shutdown(context.Background()); err != nil { t.Fatal(err) }
+
+    // a dry run of a current root leaves nothing pending
+    c, err = New(Options{StorageRoot: d.root, Demo: true, LayoutDryRun: true})
+    if err != nil { t.Fatal(err) }
+    if err := c.Start("127.0.0.1", 1004, "net"); err != nil { t.Fatalf("start: %v", err) }
+    _ = c.Shutdown(context.Background())
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    acctsvc "github.com/anyproto/any-sync/accountservice"
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+    "github.com/anyproto/any-sync/commonspace/object/acl/list"
+    "github.com/anyproto/any-sync/commonspace/object/acl/recordverifier"
+    "github.com/anyproto/any-sync/commonspace/spacestorage"
+    "github.com/anyproto/any-sync/commonspace/spacesyncproto"
+    anystore "github.com/anyproto/any-store"
+)
+
+// Local spaces are found by scanning the spaces root, so they can be listed
+// before Start and without a network. Everything comes from the stores: the
+// space header (type, creation time) and the ACL (membership and metadata,
+// which need the account keys). Open spaces are read from their live DB,
+// closed ones are opened just for the read. The provider lock is only held to
+// pick the spaces and reference the open DBs; decrypting and reading happen
+// outside it so listing never stalls the spaces in use.
+
+// LocalSpace is a space stored on this device
+type LocalSpace struct {
+    SpaceId     string `json:"spaceId"`
+    SpaceType   string `json:"spaceType"`
+    Metadata    []byte `json:"metadata"` // raw bytes, base64 in JSON
+    CreatedMs   int64  `json:"createdMs"`
+    ModifiedMs  int64  `json:"modifiedMs"` // newest file of the store
+    SizeBytes   int64  `json:"sizeBytes"`
+    Member      bool   `json:"member"`
+    Permissions string `json:"permissions"` // as in Member; empty without an account
+    Open        bool   `json:"open"`
+    // set when the store could not be read, e.g. sealed for another account
+    Error string `json:"error,omitempty"`
+}
+
+// ListLocalSpaces returns every space stored on disk, most recently modified
+// first. It works whether or not the client is started; membership and
+// metadata need a started client or an unlocked account.
+func (c *Client) ListLocalSpaces(ctx context.Context) ([]LocalSpace, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    keys := c.currentKeys()
+    p := c.storage
+    if p == nil {
+        // memory spaces only exist while the app runs
+        if c.storageOpts.Backend == StorageMemory { return []LocalSpace{}, nil }
+        var err error
+        if p, err = c.newStorageProvider(keys); err != nil { return nil, err }
+        defer p.Close(ctx)
+    }
+    out, err := p.localSpaces(ctx, keys)
+    if err != nil { return nil, err }
+    for i := range out {
+        _, err := c.getSpace(out[i].SpaceId)
+        out[i].Open = err == nil
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ModifiedMs > out[j].ModifiedMs })
+    return out, nil
+}
+
+// currentKeys are the keys of the running app, else of the unlocked account.
+// Callers hold lifecycleMu.
+func (c *Client) currentKeys() *accountdata.AccountKeys {
+    if c.app != nil { return anyapp.MustComponent[acctsvc.Service](c.app).Account() }
+    if ks := c.unlockedAccount(); ks != nil { return ks.Account() }
+    return nil
+}
+
+// listedSpace is a space picked for listing; e is its open DB, referenced
+// until the listing is done
+type listedSpace struct {
+    id string
+    e  *storeEntry
+}
+
+// localSpaces describes every space under root
+func (p *fsSpaceStorageProvider) localSpaces(ctx context.Context, keys *accountdata.AccountKeys) ([]LocalSpace, error) {
+    if p.inMemory() { return p.memorySpaces(ctx, keys) }
+    entries, err := os.ReadDir(p.root)
+    if errors.Is(err, os.ErrNotExist) { return []LocalSpace{}, nil }
+    if err != nil { return nil, err }
+    p.mu.Lock()
+    spaces := make([]listedSpace, 0, len(entries))
+    for _, ent := range entries {
+        if !ent.IsDir() || !p.spaceExists(ent.Name()) { continue }
+        spaces = append(spaces, p.pick(ent.Name()))
+    }
+    p.mu.Unlock()
+    out := make([]LocalSpace, 0, len(spaces))
+    for _, s := range spaces {
+        ls := LocalSpace{SpaceId: s.id}
+        ls.SizeBytes, ls.ModifiedMs = dirUsage(filepath.Join(p.root, s.id))
+        if s.e != nil && p.sealed() {
+            // the sealed file is only rewritten on close; the working copy is current
+            if _, ms := dirUsage(filepath.Join(p.work, s.id)); ms > ls.ModifiedMs { ls.ModifiedMs = ms }
+        }
+        if err := p.describe(ctx, &ls, s.e, keys); err != nil { ls.Error = err.Error() }
+        out = append(out, ls)
+    }
+    return out, nil
+}
+
+// memorySpaces describes the spaces of the memory backend, whose DBs are
+// all open
+func (p *fsSpaceStorageProvider) memorySpaces(ctx context.Context, keys *accountdata.AccountKeys) ([]LocalSpace, error) {
+    p.mu.Lock()
+    spaces := make([]listedSpace, 0, len(p.stores))
+    for id := range p.stores { spaces = append(spaces, p.pick(id)) }
+    p.mu.Unlock()
+    out := make([]LocalSpace, 0, len(spaces))
+    for _, s := range spaces {
+        ls := LocalSpace{SpaceId: s.id}
+        if st, err := s.e.db.Stats(ctx); err == nil { ls.SizeBytes = int64(st.TotalSizeBytes) }
+        if err := p.describe(ctx, &ls, s.e, keys); err != nil { ls.Error = err.Error() }
+        out = append(out, ls)
+    }
+    return out, nil
+}
+
+// pick references the open DB of a space, if any, so it stays open while it
+// is described. Callers hold p.mu.
+func (p *fsSpaceStorageProvider) pick(id string) listedSpace {
+    e, ok := p.stores[id]
+    if !ok { return listedSpace{id: id} }
+    e.refs++
+    return listedSpace{id: id, e: e}
+}
+
+// describe fills ls from the open DB e, or else from the store of the space,
+// opened just for the read; it drops the reference pick took on e
+func (p *fsSpaceStorageProvider) describe(ctx context.Context, ls *LocalSpace, e *storeEntry, keys *accountdata.AccountKeys) error {
+    id := ls.SpaceId
+    var db anystore.DB
+    if e != nil {
+        defer p.release(id, e)
+        db = e.db
+    } else {
+        path, cleanup, err := p.readablePath(id)
+        if err != nil { return err }
+        defer cleanup()
+        if db, err = anystore.Open(ctx, path, nil); err != nil { return err }
+        defer db.Close()
+    }
+    st, err := spacestorage.New(ctx, id, db)
+    if err != nil { return err }
+    return describeStorage(ctx, st, ls, keys)
+}
+
+// readablePath returns a plaintext DB of a space that is not open; a sealed
+// store is decrypted into a temporary copy in the work dir that cleanup removes
+func (p *fsSpaceStorageProvider) readablePath(id string) (string, func(), error) {
+    plain := filepath.Join(p.root, id, storeFile)
+    if _, err := os.Stat(plain); err == nil { return plain, func() {}, nil }
+    if !p.sealed() { return "", nil, fmt.Errorf("%s: %w (no account unlocked)", id, ErrStoreKey) }
+    gcm, err := spaceCipher(p.key, id)
+    if err != nil { return "", nil, err }
+    dir, err := os.MkdirTemp(p.work, "list-")
+    if err != nil { return "", nil, err }
+    cleanup := func() { _ = os.RemoveAll(dir) }
+    path := filepath.Join(dir, storeFile)
+    if err := unsealFile(gcm, id, p.sealedPath(id), path); err != nil { cleanup(); return "", nil, err }
+    return path, cleanup, nil
+}
+
+// describeStorage reads the space header and, with keys, the ACL
+func describeStorage(ctx context.Context, st spacestorage.SpaceStorage, ls *LocalSpace, keys *accountdata.AccountKeys) error {
+    state, err := st.StateStorage().GetState(ctx)
+    if err != nil { return fmt.Errorf("space state: %w", err) }
+    raw := &spacesyncproto.RawSpaceHeader{}
+    if err := raw.Unmarshal(state.SpaceHeader); err != nil { return fmt.Errorf("space header: %w", err) }
+    header := &spacesyncproto.SpaceHeader{}
+    if err := header.Unmarshal(raw.SpaceHeader); err != nil { return fmt.Errorf("space header: %w", err) }
+    ls.SpaceType = header.SpaceType
+    ls.CreatedMs = header.Timestamp * 1000
+    if len(header.SpaceHeaderPayload) > 0 { ls.Metadata = header.SpaceHeaderPayload }
+    if keys == nil { return nil }
+
+    aclStorage, err := st.AclStorage()
+    if err != nil { return fmt.Errorf("acl: %w", err) }
+    acl, err := list.BuildAclListWithIdentity(keys, aclStorage, recordverifier.NewValidateFull())
+    if err != nil { return fmt.Errorf("acl: %w", err) }
+    aclState := acl.AclState()
+    ls.Permissions = permissionName(aclState.Permissions(keys.SignKey.GetPublic()))
+    ls.Member = ls.Permissions != "none"
+    // the space metadata is set by the owner, encrypted with the metadata key
+    for _, acc := range aclState.CurrentAccounts() {
+        if !acc.Permissions.IsOwner() { continue }
+        if md, err := aclState.GetMetadata(acc.PubKey, true); err == nil && len(md) > 0 { ls.Metadata = md }
+        break
+    }
+    return nil
+}
+
+// dirUsage sums the file sizes under dir and finds the newest modification
+func dirUsage(dir string) (size, modMs int64) {
+    _ = filepath.WalkDir(dir, func(_ string, e fs.DirEntry, err error) error {
+        if err != nil || e.IsDir() { return nil }
+        if info, err := e.Info(); err == nil {
+            size += info.Size()
+            if ms := info.ModTime().UnixMilli(); ms > modMs { modMs = ms }
+        }
+        return nil
+    })
+    return size, modMs
+}
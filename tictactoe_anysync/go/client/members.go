@@ -0,0 +1,137 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    "github.com/anyproto/any-sync/commonspace/object/acl/list"
+    "github.com/anyproto/any-sync/util/crypto"
+)
+
+// Membership is read from the space ACL, not from the app-level
+// player_register ops: those name players, the ACL decides who may read and
+// write. Removing a member rotates the read key, so removed players cannot
+// decrypt anything written afterwards.
+
+// Member is one account of a space ACL. JoinedMs is the time of the record
+// that first gave it permissions (the ACL root for the owner).
+type Member struct {
+    Identity    string `json:"identity"`
+    Permissions string `json:"permissions"` // owner, admin, writer, reader or none
+    JoinedMs    int64  `json:"joinedMs"`
+    Self        bool   `json:"self"`
+}
+
+// AclChange is the acl_change event sent when a space ACL gets new records
+type AclChange struct {
+    Type    string   `json:"type"` // always "acl_change"
+    SpaceId string   `json:"spaceId"`
+    HeadId  string   `json:"headId"`
+    Members []Member `json:"members"`
+}
+
+const aclChangeEvent = "acl_change"
+
+func permissionName(p list.AclPermissions) string {
+    switch {
+    case p.IsOwner():
+        return "owner"
+    case p.CanManageAccounts():
+        return "admin"
+    case p.CanWrite():
+        return "writer"
+    case p.CanRead():
+        return "reader"
+    }
+    return "none"
+}
+
+// members reads the current accounts of the space ACL
+func (s *openSpace) members() []Member {
+    acl := s.space.Acl()
+    acl.RLock()
+    defer acl.RUnlock()
+    st := acl.AclState()
+    self := st.AccountKey().GetPublic()
+    var out []Member
+    for _, acc := range st.CurrentAccounts() {
+        m := Member{Identity: acc.PubKey.Account(), Permissions: permissionName(acc.Permissions), Self: acc.PubKey.Equals(self)}
+        joined := acl.Root().Id
+        if len(acc.PermissionChanges) > 0 { joined = acc.PermissionChanges[0].RecordId }
+        if rec, err := acl.Get(joined); err == nil { m.JoinedMs = rec.Timestamp * 1000 }
+        out = append(out, m)
+    }
+    return out
+}
+
+// memberKey resolves identity to the public key of a current member
+func (s *openSpace) memberKey(identity string) (crypto.PubKey, error) {
+    acl := s.space.Acl()
+    acl.RLock()
+    defer acl.RUnlock()
+    for _, acc := range acl.AclState().CurrentAccounts() {
+        if acc.PubKey.Account() == identity { return acc.PubKey, nil }
+    }
+    return nil, fmt.Errorf("%w: %s is not a member of %s", ErrInvalidArgument, identity, s.id)
+}
+
+// ListMembers returns the members of an open space from its ACL state
+func (c *Client) ListMembers(spaceId string) ([]Member, error) {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.aclSpace(spaceId)
+    if err != nil { return nil, err }
+    return s.members(), nil
+}
+
+// SetPermissions changes the permissions ("reader", "writer" or "admin") of a member
+func (c *Client) SetPermissions(ctx context.Context, spaceId, identity, permission string) error {
+    perms, err := ParsePermissions(permission)
+    if err != nil { return err }
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.aclSpace(spaceId)
+    if err != nil { return err }
+    pk, err := s.memberKey(identity)
+    if err != nil { return err }
+    err = s.space.AclClient().ChangePermissions(ctx, list.PermissionChangesPayload{
+        Changes: []list.PermissionChangePayload{{Identity: pk, Permissions: perms}},
+    })
+    if err != nil { return fmt.Errorf("set permissions of %s: %w", identity, err) }
+    return nil
+}
+
+// RemoveMember removes a member and rotates the read and metadata keys
+func (c *Client) RemoveMember(ctx context.Context, spaceId, identity string) error {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    s, err := c.aclSpace(spaceId)
+    if err != nil { return err }
+    pk, err := s.memberKey(identity)
+    if err != nil { return err }
+    metaKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+    if err != nil { return fmt.Errorf("metadata key: %w", err) }
+    err = s.space.AclClient().RemoveAccounts(ctx, list.AccountRemovePayload{
+        Identities: []crypto.PubKey{pk},
+        Change:     list.ReadKeyChangePayload{MetadataKey: metaKey, ReadKey: crypto.NewAES()},
+    })
+    if err != nil { return fmt.Errorf("remove %s: %w", identity, err) }
+    return nil
+}
+
+// emitAclChange sends an acl_change event when the ACL head moved since the
+// last check; the first check only records the head
+func (s *openSpace) emitAclChange() {
+    acl := s.space.Acl()
+    acl.RLock()
+    head := acl.Head().Id
+    acl.RUnlock()
+    s.mu.Lock()
+    prev := s.aclHead
+    s.aclHead = head
+    s.mu.Unlock()
+    if prev == "" || prev == head { return }
+    b, _ := json.Marshal(AclChange{Type: aclChangeEvent, SpaceId: s.id, HeadId: head, Members: s.members()})
+    s.emit(string(b))
+}
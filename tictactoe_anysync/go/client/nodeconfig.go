@@ -0,0 +1,56 @@
+package client
+
+import (
+    "fmt"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/anyproto/any-sync/nodeconf"
+    "gopkg.in/yaml.v3"
+)
+
+// LoadClientConfig reads the network config any-sync-dockercompose generates
+// for clients (etc/client.yml): network id plus every tree, coordinator,
+// consensus and file node with its real peer id and addresses. Configs
+// nested under a top-level "network" key (full client configs) work too.
+func LoadClientConfig(path string) (nodeconf.Configuration, error) {
+    data, err := os.ReadFile(path)
+    if err != nil { return nodeconf.Configuration{}, fmt.Errorf("read client config: %w", err) }
+    var file struct {
+        nodeconf.Configuration `yaml:",inline"`
+        Network *nodeconf.Configuration `yaml:"network"`
+    }
+    if err := yaml.Unmarshal(data, &file); err != nil { return nodeconf.Configuration{}, fmt.Errorf("%w: parse %s: %v", ErrInvalidArgument, path, err) }
+    conf := file.Configuration
+    if len(conf.Nodes) == 0 && file.Network != nil { conf = *file.Network }
+    if err := validateNodeConf(conf); err != nil { return nodeconf.Configuration{}, fmt.Errorf("%s: %w", path, err) }
+    return conf, nil
+}
+
+func validateNodeConf(conf nodeconf.Configuration) error {
+    if conf.NetworkId == "" { return fmt.Errorf("%w: networkId is missing", ErrInvalidArgument) }
+    hasTree := false
+    for i, n := range conf.Nodes {
+        if n.PeerId == "" || len(n.Addresses) == 0 { return fmt.Errorf("%w: node %d needs peerId and addresses", ErrInvalidArgument, i) }
+        if n.HasType(nodeconf.NodeTypeTree) { hasTree = true }
+    }
+    if !hasTree { return fmt.Errorf("%w: no tree node", ErrInvalidArgument) }
+    return nil
+}
+
+// treeNodeAddress is the host and port of the first tree node, for Status
+func treeNodeAddress(conf nodeconf.Configuration) (string, int) {
+    for _, n := range conf.Nodes {
+        if !n.HasType(nodeconf.NodeTypeTree) { continue }
+        for _, addr := range n.Addresses {
+            // yamux addresses have no scheme; quic ones are quic://host:port
+            if _, rest, ok := strings.Cut(addr, "://"); ok { addr = rest }
+            host, port, err := net.SplitHostPort(addr)
+            if err != nil { continue }
+            if p, err := strconv.Atoi(port); err == nil { return host, p }
+        }
+    }
+    return "", 0
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+// clientYml is an etc/client.yml as any-sync-dockercompose writes it
+const clientYml = `id: 68c0a5b4b9f8a8c3a8a1c1d2
+networkId: N9t1cx2BaA1Vq1RT1s5N2BcBaDzwvjxcrEp4rN2xeVXbGNkE
+nodes:
+  - peerId: 12D3KooWCoordinator
+    addresses:
+      - coordinator:1004
+    types:
+      - coordinator
+  - peerId: 12D3KooWTree1
+    addresses:
+      - quic://127.0.0.1:1112
+      - 127.0.0.1:1012
+    types:
+      - tree
+  - peerId: 12D3KooWFile
+    addresses:
+      - file:1005
+    types:
+      - file
+`
+
+func writeConfig(t *testing.T, data string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "client.yml")
+    if err := os.WriteFile(path, []byte(data), 0o600); err != nil { t.Fatal(err) }
+    return path
+}
+
+func TestLoadClientConfig(t *testing.T) {
+    conf, err := LoadClientConfig(writeConfig(t, clientYml))
+    if err != nil { t.Fatal(err) }
+    if conf.NetworkId != "N9t1cx2BaA1Vq1RT1s5N2BcBaDzwvjxcrEp4rN2xeVXbGNkE" || len(conf.Nodes) != 3 { t.Fatalf("config %+v", conf) }
+    if !conf.Nodes[1].HasType(nodeconf.NodeTypeTree) || conf.Nodes[1].PeerId != "12D3KooWTree1" { t.Fatalf("tree node %+v", conf.Nodes[1]) }
+    if host, port := treeNodeAddress(conf); host != "127.0.0.1" || port != 1112 { t.Fatalf("tree node address %s:%d", host, port) }
+
+    // full client configs nest the map under network
+    nested := "account:\n  peerId: x\nnetwork:\n"
+    for _, line := range strings.Split(strings.TrimSuffix(clientYml, "\n"), "\n") { nested += "  " + line + "\n" }
+    got, err := LoadClientConfig(writeConfig(t, nested))
+    if err != nil { t.Fatal(err) }
+    if got.NetworkId != conf.NetworkId || len(got.Nodes) != len(conf.Nodes) { t.Fatalf("nested config %+v", got) }
+}
+
+func TestLoadClientConfigErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        data string
+    }{
+        {"not yaml", "nodes: [\n"},
+        {"no network id", "nodes:\n  - peerId: a\n    addresses: [127.0.0.1:1]\n    types: [tree]\n"},
+        {"no tree node", "networkId: n\nnodes:\n  - peerId: a\n    addresses: [127.0.0.1:1]\n    types: [coordinator]\n"},
+        {"node without addresses", "networkId: n\nnodes:\n  - peerId: a\n    types: [tree]\n"},
+        {"node without peer id", "networkId: n\nnodes:\n  - addresses: [127.0.0.1:1]\n    types: [tree]\n"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := LoadClientConfig(writeConfig(t, tt.data))
+            if !errors.Is(err, ErrInvalidArgument) || ErrorCode(err) != CodeInvalidArgument { t.Fatalf("got %v", err) }
+        })
+    }
+    _, err := LoadClientConfig(filepath.Join(t.TempDir(), "missing.yml"))
+    if !errors.Is(err, os.ErrNotExist) || ErrorCode(err) != CodeStorage { t.Fatalf("missing file: %v (%s)", err, ErrorCode(err)) }
+}
+
+func TestTreeNodeAddress(t *testing.T) {
+    conf := nodeconf.Configuration{Nodes: []nodeconf.Node{
+        {PeerId: "c", Addresses: []string{"127.0.0.1:1004"}, Types: []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}},
+        {PeerId: "t", Addresses: []string{"not an address", "yamux-host:1012"}, Types: []nodeconf.NodeType{nodeconf.NodeTypeTree}},
+    }}
+    if host, port := treeNodeAddress(conf); host != "yamux-host" || port != 1012 { t.Fatalf("address %s:%d", host, port) }
+    if host, port := treeNodeAddress(nodeconf.Configuration{}); host != "" || port != 0 { t.Fatalf("address of an empty map %s:%d", host, port) }
+}
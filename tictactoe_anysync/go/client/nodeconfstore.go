@@ -0,0 +1,75 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/nodeconf"
+    "gopkg.in/yaml.v3"
+)
+
+const nodeConfDir = "nodeconf"
+
+// fileNodeConfStore is the nodeconf.Store of the client app. nodeconf starts
+// from the last saved network map and saves every newer one the coordinator
+// hands out, one <root>/<networkId>.yml per network. The stored map is kept
+// across restarts and wins over the address given to Start; that address
+// only bootstraps a network with no stored map yet.
+type fileNodeConfStore struct {
+    root string
+}
+
+// nodeConfStore is the store under <storage root>/nodeconf
+func (c *Client) nodeConfStore() *fileNodeConfStore {
+    return &fileNodeConfStore{root: filepath.Join(c.root, nodeConfDir)}
+}
+
+func (s *fileNodeConfStore) Init(a *anyapp.App) error { return os.MkdirAll(s.root, 0o700) }
+func (s *fileNodeConfStore) Name() string { return nodeconf.CNameStore }
+
+// path is the file of a network's map. Network ids come from the caller, so
+// ids that could name a file outside root are refused.
+func (s *fileNodeConfStore) path(netId string) (string, error) {
+    if netId == "" || strings.ContainsAny(netId, `/\`) || strings.Contains(netId, "..") {
+        return "", fmt.Errorf("%w: network id %q", ErrInvalidArgument, netId)
+    }
+    return filepath.Join(s.root, netId+".yml"), nil
+}
+
+func (s *fileNodeConfStore) GetLast(ctx context.Context, netId string) (nodeconf.Configuration, error) {
+    var c nodeconf.Configuration
+    path, err := s.path(netId)
+    if err != nil { return c, err }
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) { return c, nodeconf.ErrConfigurationNotFound }
+    if err != nil { return c, err }
+    if err := yaml.Unmarshal(data, &c); err != nil { return c, fmt.Errorf("stored node config %s: %w", netId, err) }
+    return c, nil
+}
+
+// SaveLast replaces the stored map atomically, so a crash never leaves a torn file
+func (s *fileNodeConfStore) SaveLast(ctx context.Context, c nodeconf.Configuration) error {
+    if c.NetworkId == "" { return fmt.Errorf("%w: node config without networkId", ErrInvalidArgument) }
+    path, err := s.path(c.NetworkId)
+    if err != nil { return err }
+    data, err := yaml.Marshal(c)
+    if err != nil { return err }
+    if err := os.MkdirAll(s.root, 0o700); err != nil { return err }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o600); err != nil { return err }
+    return os.Rename(tmp, path)
+}
+
+// saveIfNewer stores c unless the stored map of its network is as new, so a
+// client config never rolls back a map the coordinator handed out later
+func (s *fileNodeConfStore) saveIfNewer(ctx context.Context, c nodeconf.Configuration) error {
+    last, err := s.GetLast(ctx, c.NetworkId)
+    if err == nil && !c.CreationTime.After(last.CreationTime) { return nil }
+    if err != nil && !errors.Is(err, nodeconf.ErrConfigurationNotFound) { return err }
+    return s.SaveLast(ctx, c)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+func treeOnlyConf(id, addr string, created time.Time) nodeconf.Configuration {
+    return nodeconf.Configuration{Id: id, NetworkId: "net", CreationTime: created, Nodes: []nodeconf.Node{
+        {PeerId: "12D3KooWTree1", Addresses: []string{addr}, Types: []nodeconf.NodeType{nodeconf.NodeTypeTree}},
+    }}
+}
+
+func TestStartUsesStoredNodeConf(t *testing.T) {
+    c, err := New(Options{StorageRoot: t.TempDir()})
+    if err != nil { t.Fatal(err) }
+    t.Cleanup(func() { _ = c.Shutdown(context.Background()) })
+    ctx := context.Background()
+    if err := c.nodeConfStore().SaveLast(ctx, treeOnlyConf("saved", "saved-host:2012", time.Now())); err != nil { t.Fatal(err) }
+
+    // the saved map wins over the bootstrap address, on every start
+    for i := 0; i < 2; i++ {
+        if err := c.Start("127.0.0.1", 1004, "net"); err != nil { t.Fatal(err) }
+        if got := anyapp.MustComponent[nodeconf.Service](c.app).Configuration(); got.Id != "saved" { t.Fatalf("start %d runs with map %q", i, got.Id) }
+        if st := c.Status(); st.NodeHost != "saved-host" || st.NodePort != 2012 { t.Fatalf("start %d reports %s:%d", i, st.NodeHost, st.NodePort) }
+        if err := c.Shutdown(ctx); err != nil { t.Fatal(err) }
+    }
+    if _, err := os.Stat(filepath.Join(c.root, nodeConfDir, "net.yml")); err != nil { t.Fatalf("stored map after restarts: %v", err) }
+}
+
+func TestNodeConfStoreSaveIfNewer(t *testing.T) {
+    s := &fileNodeConfStore{root: t.TempDir()}
+    ctx := context.Background()
+    now := time.Now()
+    if _, err := s.GetLast(ctx, "net"); !errors.Is(err, nodeconf.ErrConfigurationNotFound) { t.Fatalf("empty store: %v", err) }
+    if err := s.saveIfNewer(ctx, treeOnlyConf("first", "a:1", now)); err != nil { t.Fatal(err) }
+    // an older client config does not roll the map back, a newer one replaces it
+    if err := s.saveIfNewer(ctx, treeOnlyConf("older", "b:1", now.Add(-time.Hour))); err != nil { t.Fatal(err) }
+    if got, _ := s.GetLast(ctx, "net"); got.Id != "first" { t.Fatalf("stored %q after an older config", got.Id) }
+    if err := s.saveIfNewer(ctx, treeOnlyConf("newer", "c:1", now.Add(time.Hour))); err != nil { t.Fatal(err) }
+    got, err := s.GetLast(ctx, "net")
+    if err != nil || got.Id != "newer" || got.Nodes[0].Addresses[0] != "c:1" { t.Fatalf("stored %+v, %v", got, err) }
+}
+
+func TestNodeConfStoreNetworkId(t *testing.T) {
+    s := &fileNodeConfStore{root: t.TempDir()}
+    for _, id := range []string{"", "../keystore", "a/b", `a\b`, "..", "a..b"} {
+        if _, err := s.GetLast(context.Background(), id); !errors.Is(err, ErrInvalidArgument) { t.Errorf("get %q: %v", id, err) }
+        conf := treeOnlyConf("x", "a:1", time.Now())
+        conf.NetworkId = id
+        if err := s.SaveLast(context.Background(), conf); !errors.Is(err, ErrInvalidArgument) { t.Errorf("save %q: %v", id, err) }
+    }
+    if entries, _ := os.ReadDir(filepath.Dir(s.root)); len(entries) != 1 { t.Fatalf("files written outside the store: %v", entries) }
+}
@@ -0,0 +1,302 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/anyproto/any-sync/commonspace/object/keyvalue/keyvaluestorage"
+    "github.com/anyproto/any-sync/commonspace/object/keyvalue/keyvaluestorage/innerstorage"
+)
+
+// Operation log layout inside the space KeyValue store:
+//
+//   ops/<session>/<opId>
+//
+// Every operation gets its own key so peers never overwrite each other. The
+// opId is <clock>-<peer id>-<seq>, where clock is a Lamport clock: one more
+// than the highest clock in the log when the op was sent. Every peer orders
+// the log by (clock, signing peer id, session, opId), which only uses data
+// that syncs unchanged, so all peers see the same order and an op always
+// comes after every op its sender had seen. A cursor names a position in
+// that order and stays valid across reopens and devices. An op sent
+// concurrently with ones a reader already passed can sort before its cursor;
+// its live event still fires and a full read includes it.
+const opKeyPrefix = "ops/"
+
+// session bucket for operations that carry no sessionId (player_register, snapshots)
+const opGlobalSession = "global"
+
+// retrySkippedEvery throttles reloading the log while entries cannot be decrypted
+const retrySkippedEvery = 10 * time.Second
+
+var opSeq atomic.Uint64
+
+// OpEntry is one operation of the log; Cursor is its position in the log order
+type OpEntry struct {
+    Cursor  string          `json:"cursor"`
+    OpId    string          `json:"opId"`
+    Session string          `json:"session"`
+    PeerId  string          `json:"peerId"`
+    Op      json.RawMessage `json:"op"`
+}
+
+// SkippedOp is a log entry that could not be read, e.g. encrypted with a read
+// key this device does not have yet; it is retried until it can be
+type SkippedOp struct {
+    Key    string `json:"key"`
+    PeerId string `json:"peerId"`
+    Error  string `json:"error"`
+}
+
+// OpPage is the result of ReadOperations; Cursor resumes after the last
+// entry and Skipped lists the entries the log is missing
+type OpPage struct {
+    Operations []OpEntry   `json:"operations"`
+    Cursor     string      `json:"cursor"`
+    Skipped    []SkippedOp `json:"skipped"`
+}
+
+func opSession(op map[string]any) string {
+    switch v := op["sessionId"].(type) {
+    case float64:
+        return strconv.FormatInt(int64(v), 10)
+    case string:
+        if v != "" { return v }
+    }
+    return opGlobalSession
+}
+
+// newOpId builds a unique operation id: <clock:016d>-<peerId>-<seq:08d>
+func newOpId(clock uint64, peerId string) string {
+    return fmt.Sprintf("%016d-%s-%08d", clock, peerId, opSeq.Add(1))
+}
+
+// opClock is the Lamport clock of an opId; 0 when it has none
+func opClock(opId string) uint64 {
+    s, _, _ := strings.Cut(opId, "-")
+    n, _ := strconv.ParseUint(s, 10, 64)
+    return n
+}
+
+func opKey(session, opId string) string { return opKeyPrefix + session + "/" + opId }
+
+// parseOpKey splits ops/<session>/<opId>; ok is false for keys outside the log
+func parseOpKey(key string) (session, opId string, ok bool) {
+    if !strings.HasPrefix(key, opKeyPrefix) { return "", "", false }
+    rest := strings.TrimPrefix(key, opKeyPrefix)
+    i := strings.IndexByte(rest, '/')
+    if i <= 0 || i == len(rest)-1 { return "", "", false }
+    return rest[:i], rest[i+1:], true
+}
+
+// newOpEntry parses the payload of a local operation into a log entry with
+// the given clock
+func newOpEntry(clock uint64, peerId string, jsonData []byte) (OpEntry, error) {
+    var op map[string]any
+    if err := json.Unmarshal(jsonData, &op); err != nil { return OpEntry{}, fmt.Errorf("json parse: %w", err) }
+    return OpEntry{OpId: newOpId(clock, peerId), Session: opSession(op), PeerId: peerId, Op: json.RawMessage(jsonData)}, nil
+}
+
+// decodeOps turns stored values into log entries; values outside the log are
+// ignored and those that cannot be decrypted or parsed are returned as skipped
+func decodeOps(dec keyvaluestorage.Decryptor, values ...innerstorage.KeyValue) (entries []OpEntry, skipped []SkippedOp) {
+    for _, v := range values {
+        session, opId, ok := parseOpKey(v.Key)
+        if !ok { continue }
+        data, err := dec(v)
+        if err == nil && !json.Valid(data) { err = fmt.Errorf("not a JSON operation") }
+        if err != nil { skipped = append(skipped, SkippedOp{Key: v.Key, PeerId: v.PeerId, Error: err.Error()}); continue }
+        entries = append(entries, OpEntry{OpId: opId, Session: session, PeerId: v.PeerId, Op: json.RawMessage(data)})
+    }
+    return entries, skipped
+}
+
+// loadOperations returns every log entry of the store, unordered
+func loadOperations(ctx context.Context, store keyvaluestorage.Storage) ([]OpEntry, []SkippedOp, error) {
+    var entries []OpEntry
+    var skipped []SkippedOp
+    err := store.Iterate(ctx, func(dec keyvaluestorage.Decryptor, key string, values []innerstorage.KeyValue) (bool, error) {
+        if _, _, ok := parseOpKey(key); !ok { return true, nil }
+        e, s := decodeOps(dec, values...)
+        entries, skipped = append(entries, e...), append(skipped, s...)
+        return true, nil
+    })
+    return entries, skipped, err
+}
+
+// opIndexer feeds the op index of a space from its KeyValue store: the store
+// calls Index for every value it saves, local or synced, so the log is read
+// in full only once, when the space is opened
+type opIndexer struct {
+    keyvaluestorage.NoOpIndexer
+    log    *opIndex
+    wakeCh chan struct{}
+}
+
+func newOpIndexer() *opIndexer {
+    return &opIndexer{log: newOpIndex(true), wakeCh: make(chan struct{}, 1)}
+}
+
+func (x *opIndexer) Index(dec keyvaluestorage.Decryptor, values ...innerstorage.KeyValue) error {
+    entries, skipped := decodeOps(dec, values...)
+    x.log.add(entries...)
+    x.log.skip(skipped...)
+    if len(entries) > 0 {
+        select {
+        case x.wakeCh <- struct{}{}:
+        default:
+        }
+    }
+    return nil
+}
+
+// opPos is the sort key of an entry; cursors encode it
+type opPos struct {
+    clock   uint64
+    peerId  string
+    session string
+    opId    string
+}
+
+func posOf(e OpEntry) opPos { return opPos{opClock(e.OpId), e.PeerId, e.Session, e.OpId} }
+
+func (a opPos) less(b opPos) bool {
+    if a.clock != b.clock { return a.clock < b.clock }
+    if a.peerId != b.peerId { return a.peerId < b.peerId }
+    if a.session != b.session { return a.session < b.session }
+    return a.opId < b.opId
+}
+
+// cursor is <clock:016d>/<peerId>/<session>/<opId>; peer ids and sessions
+// never contain a slash
+func (a opPos) cursor() string { return fmt.Sprintf("%016d/%s/%s/%s", a.clock, a.peerId, a.session, a.opId) }
+
+func parseCursor(c string) (opPos, bool) {
+    parts := strings.SplitN(c, "/", 4)
+    if len(parts) != 4 { return opPos{}, false }
+    clock, err := strconv.ParseUint(parts[0], 10, 64)
+    if err != nil { return opPos{}, false }
+    return opPos{clock, parts[1], parts[2], parts[3]}, true
+}
+
+// opIndex holds the log of one open space in log order. Entries are added
+// as they are seen; fresh keeps those not yet emitted to the listener, in
+// the order they arrived, when the space has one.
+type opIndex struct {
+    mu      sync.Mutex
+    known   map[string]struct{}
+    log     []OpEntry
+    clock   uint64
+    track   bool
+    fresh   []OpEntry
+    skipped map[string]SkippedOp
+    // set once the store was read in full
+    loaded   bool
+    loadedAt time.Time
+}
+
+func newOpIndex(track bool) *opIndex {
+    return &opIndex{known: make(map[string]struct{}), skipped: make(map[string]SkippedOp), track: track}
+}
+
+func entryKey(e OpEntry) string { return opKey(e.Session, e.OpId) + ":" + e.PeerId }
+
+// add indexes the entries not seen before and returns them
+func (ix *opIndex) add(entries ...OpEntry) []OpEntry {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    var added []OpEntry
+    for _, e := range entries {
+        k := entryKey(e)
+        if _, ok := ix.known[k]; ok { continue }
+        ix.known[k] = struct{}{}
+        delete(ix.skipped, k)
+        pos := posOf(e)
+        e.Cursor = pos.cursor()
+        if pos.clock > ix.clock { ix.clock = pos.clock }
+        i := sort.Search(len(ix.log), func(i int) bool { return pos.less(posOf(ix.log[i])) })
+        ix.log = append(ix.log, OpEntry{})
+        copy(ix.log[i+1:], ix.log[i:])
+        ix.log[i] = e
+        added = append(added, e)
+    }
+    if ix.track { ix.fresh = append(ix.fresh, added...) }
+    return added
+}
+
+// skip records entries that could not be read
+func (ix *opIndex) skip(skipped ...SkippedOp) {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    for _, s := range skipped {
+        k := s.Key + ":" + s.PeerId
+        if _, ok := ix.known[k]; !ok { ix.skipped[k] = s }
+    }
+}
+
+// needsLoad reports whether the store has to be read in full: once, then
+// every retrySkippedEvery while entries are skipped
+func (ix *opIndex) needsLoad(now time.Time) bool {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    return !ix.loaded || (len(ix.skipped) > 0 && now.Sub(ix.loadedAt) >= retrySkippedEvery)
+}
+
+// load adds a full read of the store; what it still cannot read replaces the
+// skipped entries
+func (ix *opIndex) load(entries []OpEntry, skipped []SkippedOp, now time.Time) {
+    ix.add(entries...)
+    ix.mu.Lock()
+    ix.skipped = make(map[string]SkippedOp)
+    ix.loaded, ix.loadedAt = true, now
+    ix.mu.Unlock()
+    ix.skip(skipped...)
+}
+
+// nextClock is the Lamport clock of the next local operation
+func (ix *opIndex) nextClock() uint64 {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    return ix.clock + 1
+}
+
+// since returns the entries after cursor in log order; an empty or unknown
+// cursor returns all of them
+func (ix *opIndex) since(cursor string) []OpEntry {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    from := 0
+    if pos, ok := parseCursor(cursor); ok {
+        from = sort.Search(len(ix.log), func(i int) bool { return pos.less(posOf(ix.log[i])) })
+    }
+    return append([]OpEntry{}, ix.log[from:]...)
+}
+
+// takeFresh returns the entries added since the last call, in arrival order
+func (ix *opIndex) takeFresh() []OpEntry {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    fresh := ix.fresh
+    ix.fresh = nil
+    return fresh
+}
+
+// skippedOps lists the entries that could not be read, sorted by key
+func (ix *opIndex) skippedOps() []SkippedOp {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    out := make([]SkippedOp, 0, len(ix.skipped))
+    for _, s := range ix.skipped { out = append(out, s) }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Key != out[j].Key { return out[i].Key < out[j].Key }
+        return out[i].PeerId < out[j].PeerId
+    })
+    return out
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func logEntry(clock uint64, peer, session string) OpEntry {
+    op := fmt.Sprintf(`{"type":"tictactoe_move","playerId":"%s","clock":%d}`, peer, clock)
+    return OpEntry{OpId: fmt.Sprintf("%016d-%s-%08d", clock, peer, 1), Session: session, PeerId: peer, Op: []byte(op)}
+}
+
+// concurrent sends of three peers, and what each sent after seeing them
+var sampleLog = []OpEntry{
+    logEntry(1, "a", "1"), logEntry(1, "b", "1"), logEntry(2, "c", "global"),
+    logEntry(3, "a", "1"), logEntry(3, "b", "1"), logEntry(4, "c", "2"),
+}
+
+func indexed(entries ...OpEntry) *opIndex {
+    ix := newOpIndex(true)
+    ix.add(entries...)
+    return ix
+}
+
+func reversed(entries []OpEntry) []OpEntry {
+    out := make([]OpEntry, len(entries))
+    for i, e := range entries { out[len(entries)-1-i] = e }
+    return out
+}
+
+func opIds(entries []OpEntry) []string {
+    ids := make([]string, len(entries))
+    for i, e := range entries { ids[i] = e.OpId }
+    return ids
+}
+
+func TestOpIndexOrderIsDeterministic(t *testing.T) {
+    // two peers receive the same ops in opposite orders
+    a, b := indexed(sampleLog...).since(""), indexed(reversed(sampleLog)...).since("")
+    if !reflect.DeepEqual(a, b) { t.Fatalf("orders differ:\n%v\n%v", opIds(a), opIds(b)) }
+    want := []string{sampleLog[0].OpId, sampleLog[1].OpId, sampleLog[2].OpId, sampleLog[3].OpId, sampleLog[4].OpId, sampleLog[5].OpId}
+    if got := opIds(a); !reflect.DeepEqual(got, want) { t.Fatalf("order %v, want %v", got, want) }
+    for i := 1; i < len(a); i++ {
+        if a[i].Cursor == a[i-1].Cursor { t.Fatalf("duplicate cursor %s", a[i].Cursor) }
+    }
+}
+
+func TestOpIndexCursorAcrossIndexes(t *testing.T) {
+    first := indexed(sampleLog...)
+    cursor := first.since("")[2].Cursor
+    // a reopened space, or another device, resumes at the same position
+    reopened := indexed(reversed(sampleLog)...)
+    got, want := reopened.since(cursor), first.since(cursor)
+    if !reflect.DeepEqual(got, want) || len(got) != 3 { t.Fatalf("since %s: %v, want %v", cursor, opIds(got), opIds(want)) }
+    if got := reopened.since(reopened.since("")[5].Cursor); len(got) != 0 { t.Fatalf("after the last entry: %v", opIds(got)) }
+    // a cursor that is not a position returns everything
+    for _, c := range []string{"", "deadbeef-000000000003", "x/y/z/w"} {
+        if got := reopened.since(c); len(got) != len(sampleLog) { t.Fatalf("cursor %q: %d entries", c, len(got)) }
+    }
+}
+
+func TestOpIndexLateOp(t *testing.T) {
+    ix := indexed(logEntry(5, "a", "1"), logEntry(6, "b", "1"))
+    cursor := ix.since("")[1].Cursor
+    ix.takeFresh()
+    // sent before its sender saw the others
+    late := logEntry(2, "c", "1")
+    if added := ix.add(late); len(added) != 1 { t.Fatalf("added %v", added) }
+    if got := opIds(ix.since("")); got[0] != late.OpId { t.Fatalf("late op not first: %v", got) }
+    if got := ix.since(cursor); len(got) != 0 { t.Fatalf("late op after the cursor: %v", opIds(got)) }
+    if fresh := ix.takeFresh(); len(fresh) != 1 || fresh[0].OpId != late.OpId { t.Fatalf("fresh %v", opIds(fresh)) }
+    if fresh := ix.takeFresh(); len(fresh) != 0 { t.Fatalf("fresh twice: %v", opIds(fresh)) }
+    if n := ix.nextClock(); n != 7 { t.Fatalf("next clock %d, want 7", n) }
+}
+
+func TestOpIndexDuplicates(t *testing.T) {
+    ix := indexed(sampleLog...)
+    if added := ix.add(sampleLog...); len(added) != 0 { t.Fatalf("re-added %v", opIds(added)) }
+    // the same op id signed by another peer is another entry
+    other := sampleLog[0]
+    other.PeerId = "z"
+    if added := ix.add(other); len(added) != 1 { t.Fatalf("added %v", opIds(added)) }
+    if n := len(ix.since("")); n != len(sampleLog)+1 { t.Fatalf("%d entries", n) }
+    // demo indexes keep no fresh entries
+    demo := newOpIndex(false)
+    demo.add(sampleLog...)
+    if len(demo.takeFresh()) != 0 { t.Fatal("untracked index kept fresh entries") }
+}
+
+func TestOpIndexSkipped(t *testing.T) {
+    ix := newOpIndex(true)
+    now := time.Now()
+    if !ix.needsLoad(now) { t.Fatal("not loaded yet") }
+    e := logEntry(1, "a", "1")
+    bad := SkippedOp{Key: opKey(e.Session, e.OpId), PeerId: e.PeerId, Error: "no read key"}
+    ix.load(nil, []SkippedOp{bad}, now)
+    if got := ix.skippedOps(); len(got) != 1 || got[0] != bad { t.Fatalf("skipped %v", got) }
+    if ix.needsLoad(now.Add(time.Second)) { t.Fatal("retried before the throttle") }
+    if !ix.needsLoad(now.Add(retrySkippedEvery)) { t.Fatal("skipped entries never retried") }
+    // readable now
+    ix.load([]OpEntry{e}, nil, now.Add(retrySkippedEvery))
+    if got := ix.skippedOps(); len(got) != 0 { t.Fatalf("still skipped %v", got) }
+    if ix.needsLoad(now.Add(time.Hour)) { t.Fatal("reload without skipped entries") }
+    // an indexed entry is never reported as skipped
+    ix.skip(bad)
+    if got := ix.skippedOps(); len(got) != 0 { t.Fatalf("skipped an indexed entry: %v", got) }
+}
+
+func TestOpIdsAndKeys(t *testing.T) {
+    id := newOpId(42, "peer")
+    if c := opClock(id); c != 42 { t.Fatalf("clock of %s = %d", id, c) }
+    if c := opClock("junk-id"); c != 0 { t.Fatalf("clock of junk = %d", c) }
+    session, opId, ok := parseOpKey(opKey("3", id))
+    if !ok || session != "3" || opId != id { t.Fatalf("parsed %q %q %v", session, opId, ok) }
+    for _, k := range []string{"moves", "ops/", "ops/3", "ops/3/", "ops//x"} {
+        if _, _, ok := parseOpKey(k); ok { t.Fatalf("%q parsed as an op key", k) }
+    }
+    e, err := newOpEntry(9, "peer", []byte(`{"type":"tictactoe_reset","sessionId":4}`))
+    if err != nil || e.Session != "4" || opClock(e.OpId) != 9 { t.Fatalf("entry %+v, %v", e, err) }
+    if e, _ := newOpEntry(1, "peer", []byte(`{"type":"player_register"}`)); e.Session != opGlobalSession { t.Fatalf("session %q", e.Session) }
+    if _, err := newOpEntry(1, "peer", []byte(`{`)); err == nil { t.Fatal("parsed broken JSON") }
+}
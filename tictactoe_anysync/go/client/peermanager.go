@@ -0,0 +1,84 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace/peermanager"
+    anynet "github.com/anyproto/any-sync/net"
+    "github.com/anyproto/any-sync/net/peer"
+    "github.com/anyproto/any-sync/net/pool"
+    "github.com/anyproto/any-sync/net/streampool"
+    "github.com/anyproto/any-sync/nodeconf"
+    "storj.io/drpc"
+)
+
+// peerManagerProvider is the peermanager.PeerManagerProvider of the client
+// app. Clients only talk to nodes: the responsible peers of a space are its
+// nodes from nodeconf, dialed through the pool, and messages go over the
+// ObjectSyncStreams the stream handler opens to them. Node-to-node concerns
+// of the any-sync-node peer manager (serving other peers' streams) do not
+// apply here.
+type peerManagerProvider struct {
+    pool    pool.Pool
+    nodes   nodeconf.Service
+    streams streampool.StreamPool
+}
+
+func newPeerManagerProvider() *peerManagerProvider { return &peerManagerProvider{} }
+
+func (p *peerManagerProvider) Init(a *anyapp.App) error {
+    p.pool = a.MustComponent(pool.CName).(pool.Pool)
+    p.nodes = a.MustComponent(nodeconf.CName).(nodeconf.Service)
+    p.streams = a.MustComponent(streampool.CName).(streampool.StreamPool)
+    return nil
+}
+
+func (p *peerManagerProvider) Name() string { return peermanager.CName }
+
+func (p *peerManagerProvider) NewPeerManager(ctx context.Context, spaceId string) (peermanager.PeerManager, error) {
+    return &spacePeerManager{provider: p, spaceId: spaceId}, nil
+}
+
+// spacePeerManager is the peer manager of one space
+type spacePeerManager struct {
+    provider *peerManagerProvider
+    spaceId  string
+}
+
+func (m *spacePeerManager) Init(a *anyapp.App) error { return nil }
+func (m *spacePeerManager) Name() string { return peermanager.CName }
+
+// GetResponsiblePeers returns the responsible nodes that could be dialed; it
+// fails only when none of them answers
+func (m *spacePeerManager) GetResponsiblePeers(ctx context.Context) ([]peer.Peer, error) {
+    ids := m.provider.nodes.NodeIds(m.spaceId)
+    if len(ids) == 0 { return nil, fmt.Errorf("%w: no responsible nodes for space %s", anynet.ErrUnableToConnect, m.spaceId) }
+    var peers []peer.Peer
+    var errs []error
+    for _, id := range ids {
+        p, err := m.provider.pool.Get(ctx, id)
+        if err != nil { errs = append(errs, err); continue }
+        peers = append(peers, p)
+    }
+    if len(peers) == 0 { return nil, fmt.Errorf("%w: space %s: %w", anynet.ErrUnableToConnect, m.spaceId, errors.Join(errs...)) }
+    return peers, nil
+}
+
+// GetNodePeers is GetResponsiblePeers: every peer of a client is a node
+func (m *spacePeerManager) GetNodePeers(ctx context.Context) ([]peer.Peer, error) {
+    return m.GetResponsiblePeers(ctx)
+}
+
+func (m *spacePeerManager) BroadcastMessage(ctx context.Context, msg drpc.Message) error {
+    return m.provider.streams.Send(ctx, msg, m.GetResponsiblePeers)
+}
+
+func (m *spacePeerManager) SendMessage(ctx context.Context, peerId string, msg drpc.Message) error {
+    return m.provider.streams.SendById(ctx, msg, peerId)
+}
+
+// KeepAlive dials the responsible nodes so the pool keeps their connections
+func (m *spacePeerManager) KeepAlive(ctx context.Context) { _, _ = m.GetResponsiblePeers(ctx) }
@@ -0,0 +1,298 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/anyproto/any-sync/commonspace"
+    "github.com/anyproto/any-sync/commonspace/object/keyvalue/keyvaluestorage"
+    "github.com/anyproto/any-sync/net/peer"
+)
+
+var ErrSpaceNotOpen = errors.New("space is not open")
+
+// openSpace is one entry of the client's space registry. Each open space has
+// its own KeyValue store, listener goroutine, op index and sync status.
+// Demo spaces have no any-sync space and keep their log only in the index.
+type openSpace struct {
+    id       string
+    space    commonspace.Space
+    store    keyvaluestorage.Storage
+    kvSync   any
+    events   EventSink
+    // storage root for crash reports of the listener
+    crashRoot string
+    treeSync *treeSyncer
+    streams  *streamHandler
+    // wakeCh makes the listener run right away (new log entries, pushed updates)
+    wakeCh   chan struct{}
+    // aclCh wakes watchAcl after syncacl added records
+    aclCh    chan struct{}
+    openedAt time.Time
+    log      *opIndex
+    // sendMu serializes validate+append of local operations
+    sendMu sync.Mutex
+
+    mu        sync.Mutex
+    cancel    context.CancelFunc
+    done      chan struct{}
+    aclCancel context.CancelFunc
+    aclDone   chan struct{}
+    // join request record ids already announced
+    seenRequests map[string]struct{}
+    // ACL head at the last check, for acl_change events
+    aclHead string
+    lastSync  time.Time
+    peerCount int
+}
+
+// SpaceInfo describes one open space
+type SpaceInfo struct {
+    SpaceId    string `json:"spaceId"`
+    Demo       bool   `json:"demo"`
+    Listening  bool   `json:"listening"`
+    PeerCount  int    `json:"peerCount"`
+    LastSyncMs int64  `json:"lastSyncMs"`
+    OpenedMs   int64  `json:"openedMs"`
+    // tree sync progress; nil for demo spaces
+    TreeSync *TreeSyncProgress `json:"treeSync,omitempty"`
+}
+
+// newOpenSpace wraps sp, whose KeyValue store feeds ix; crash reports of its
+// listener go under crashRoot
+func newOpenSpace(sp commonspace.Space, ix *opIndexer, events EventSink, crashRoot string) (*openSpace, error) {
+    kv := sp.KeyValue()
+    if kv == nil { return nil, fmt.Errorf("KeyValue service missing") }
+    return &openSpace{id: sp.Id(), space: sp, store: kv.DefaultStore(), kvSync: kv, events: events, crashRoot: crashRoot, wakeCh: ix.wakeCh, aclCh: make(chan struct{}, 1), openedAt: time.Now(), log: ix.log, seenRequests: make(map[string]struct{})}, nil
+}
+
+func newDemoSpace(id string, events EventSink) *openSpace {
+    return &openSpace{id: id, events: events, wakeCh: make(chan struct{}, 1), openedAt: time.Now(), log: newOpIndex(false)}
+}
+
+func (s *openSpace) demo() bool { return s.space == nil }
+
+// refreshLog reads the KeyValue store in full the first time and, throttled,
+// while entries cannot be decrypted; the indexer adds everything else
+func (s *openSpace) refreshLog(ctx context.Context) error {
+    now := time.Now()
+    if s.demo() || !s.log.needsLoad(now) { return nil }
+    entries, skipped, err := loadOperations(ctx, s.store)
+    if err != nil { return err }
+    s.log.load(entries, skipped, now)
+    return nil
+}
+
+func (s *openSpace) readOperations(ctx context.Context, sinceCursor string) ([]OpEntry, error) {
+    if err := s.refreshLog(ctx); err != nil { return nil, err }
+    return s.log.since(sinceCursor), nil
+}
+
+// sendOperation validates the payload against the materialized board and
+// appends it to the space log. sendMu keeps concurrent local sends from
+// validating against the same board.
+func (s *openSpace) sendOperation(ctx context.Context, peerId string, jsonData []byte) error {
+    s.sendMu.Lock()
+    defer s.sendMu.Unlock()
+    entries, err := s.readOperations(ctx, "")
+    if err != nil { return err }
+    if err := validateOperation(entries, peerId, jsonData); err != nil { return err }
+    return s.appendLocked(ctx, peerId, jsonData)
+}
+
+// appendLocked adds a validated operation to the space log under the next
+// Lamport clock. Callers hold sendMu.
+func (s *openSpace) appendLocked(ctx context.Context, peerId string, jsonData []byte) error {
+    if err := s.refreshLog(ctx); err != nil { return err }
+    e, err := newOpEntry(s.log.nextClock(), peerId, jsonData)
+    if err != nil { return err }
+    if s.demo() {
+        s.log.add(e)
+        s.emit(string(jsonData))
+        return nil
+    }
+    if err := s.store.Set(ctx, opKey(e.Session, e.OpId), jsonData); err != nil { return err }
+    // the indexer adds it too; adding here keeps the clock current either way
+    s.log.add(e)
+    return nil
+}
+
+// startListening launches the per-space listener; calling it twice is a no-op
+func (s *openSpace) startListening() {
+    if s.demo() { return }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.cancel != nil { return }
+    ctx, cancel := context.WithCancel(context.Background())
+    s.cancel = cancel
+    s.done = make(chan struct{})
+    go s.listen(ctx, s.done)
+}
+
+func (s *openSpace) listen(ctx context.Context, done chan struct{}) {
+    defer close(done)
+    defer recoverGo(s.crashRoot, "listen "+s.id)
+    ticker := time.NewTicker(300 * time.Millisecond)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        case <-s.wakeCh:
+        }
+        // emit every entry indexed since the last round, late ops (lower
+        // clock) included
+        if err := s.refreshLog(ctx); err != nil { log.Printf("listen %s: read log: %v", s.id, err) }
+        for _, e := range s.log.takeFresh() { s.emit(string(e.Op)) }
+        // Opportunistic sync with node peers to pull remote updates if any
+        peers, err := s.space.GetNodePeers(ctx)
+        if err != nil { continue }
+        s.mu.Lock()
+        s.peerCount = len(peers)
+        s.mu.Unlock()
+        if s.streams != nil { s.streams.connect(peers) }
+        type syncer interface{ SyncWithPeer(peer.Peer) error }
+        kv, ok := s.kvSync.(syncer)
+        if !ok { continue }
+        for _, p := range peers {
+            _ = kv.SyncWithPeer(p)
+            s.mu.Lock()
+            s.lastSync = time.Now()
+            s.mu.Unlock()
+        }
+    }
+}
+
+// startAclWatch hooks the space into syncacl updates and runs watchAcl until
+// the space is closed
+func (s *openSpace) startAclWatch() {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    s.mu.Lock()
+    s.aclCancel, s.aclDone = cancel, done
+    s.mu.Unlock()
+    s.space.Acl().SetAclUpdater(s)
+    go s.watchAcl(ctx, done)
+}
+
+// stopListening cancels the listener and waits for it to exit
+func (s *openSpace) stopListening() {
+    s.mu.Lock()
+    cancel, done := s.cancel, s.done
+    s.cancel, s.done = nil, nil
+    s.mu.Unlock()
+    if cancel == nil { return }
+    cancel()
+    <-done
+}
+
+// wake nudges the listener; it never blocks
+func (s *openSpace) wake() {
+    select {
+    case s.wakeCh <- struct{}{}:
+    default:
+    }
+}
+
+func (s *openSpace) emit(data string) {
+    if s.events != nil { s.events.Dispatch(s.id, data) }
+}
+
+func (s *openSpace) close() error {
+    s.stopListening()
+    if s.demo() { return nil }
+    s.mu.Lock()
+    cancel, done := s.aclCancel, s.aclDone
+    s.mu.Unlock()
+    if cancel != nil { cancel(); <-done }
+    return s.space.Close()
+}
+
+func (s *openSpace) info() SpaceInfo {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    in := SpaceInfo{SpaceId: s.id, Demo: s.demo(), Listening: s.cancel != nil, PeerCount: s.peerCount, OpenedMs: s.openedAt.UnixMilli()}
+    if !s.lastSync.IsZero() { in.LastSyncMs = s.lastSync.UnixMilli() }
+    if s.treeSync != nil {
+        p := s.treeSync.snapshot()
+        in.TreeSync = &p
+    }
+    return in
+}
+
+// ---------------- registry -----------------
+
+// registerSpace adds an opened space; an already open space with the same id
+// is kept and the new handle closed, so double joins are harmless.
+func (c *Client) registerSpace(s *openSpace) *openSpace {
+    c.spacesMu.Lock()
+    defer c.spacesMu.Unlock()
+    if existing, ok := c.spaces[s.id]; ok {
+        if s != existing && !s.demo() { _ = s.space.Close() }
+        return existing
+    }
+    c.spaces[s.id] = s
+    c.lastSpaceId = s.id
+    return s
+}
+
+func (c *Client) getSpace(id string) (*openSpace, error) {
+    c.spacesMu.RLock()
+    defer c.spacesMu.RUnlock()
+    s, ok := c.spaces[id]
+    if !ok { return nil, fmt.Errorf("%w: %s", ErrSpaceNotOpen, id) }
+    return s, nil
+}
+
+// CloseSpace stops the space listener and closes the space
+func (c *Client) CloseSpace(id string) error {
+    c.lifecycleMu.RLock()
+    defer c.lifecycleMu.RUnlock()
+    return c.closeSpace(id)
+}
+
+// closeSpace is CloseSpace for callers that hold lifecycleMu for reading
+func (c *Client) closeSpace(id string) error {
+    c.spacesMu.Lock()
+    s, ok := c.spaces[id]
+    delete(c.spaces, id)
+    if c.lastSpaceId == id { c.lastSpaceId = "" }
+    c.spacesMu.Unlock()
+    if !ok { return fmt.Errorf("%w: %s", ErrSpaceNotOpen, id) }
+    log.Printf("Closing space: %s", id)
+    if c.trees != nil { c.trees.closeSpace(id) }
+    if c.streams != nil && !s.demo() { c.streams.unsubscribe(id) }
+    return s.close()
+}
+
+// syncedSpaceIds lists the open non-demo spaces, for stream subscriptions
+func (c *Client) syncedSpaceIds() []string {
+    c.spacesMu.RLock()
+    defer c.spacesMu.RUnlock()
+    ids := make([]string, 0, len(c.spaces))
+    for id, s := range c.spaces {
+        if !s.demo() { ids = append(ids, id) }
+    }
+    return ids
+}
+
+// wakeSpace lets the space listener pick up a pushed update immediately
+func (c *Client) wakeSpace(id string) {
+    if s, err := c.getSpace(id); err == nil { s.wake() }
+}
+
+// ListSpaces returns the open spaces, oldest first
+func (c *Client) ListSpaces() []SpaceInfo {
+    c.spacesMu.RLock()
+    list := make([]SpaceInfo, 0, len(c.spaces))
+    for _, s := range c.spaces { list = append(list, s.info()) }
+    c.spacesMu.RUnlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].OpenedMs < list[j].OpenedMs })
+    return list
+}
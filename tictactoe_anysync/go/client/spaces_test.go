@@ -0,0 +1,88 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+)
+
+// recordingSink keeps the events dispatched to each space
+type recordingSink struct {
+    mu     sync.Mutex
+    events map[string][]string
+}
+
+func (r *recordingSink) Dispatch(spaceId string, op string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.events == nil { r.events = make(map[string][]string) }
+    r.events[spaceId] = append(r.events[spaceId], op)
+}
+
+func (r *recordingSink) count(spaceId string) int {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return len(r.events[spaceId])
+}
+
+func startDemo(t *testing.T, sink EventSink) *Client {
+    t.Helper()
+    c, err := New(Options{StorageRoot: t.TempDir(), Demo: true, Events: sink})
+    if err != nil { t.Fatal(err) }
+    if err := c.Start("127.0.0.1", 1004, "net"); err != nil { t.Fatal(err) }
+    t.Cleanup(func() { _ = c.Shutdown(context.Background()) })
+    return c
+}
+
+func TestSpacesAreIndependent(t *testing.T) {
+    sink := &recordingSink{}
+    c := startDemo(t, sink)
+    ctx := context.Background()
+    for _, id := range []string{"a", "b"} {
+        if err := c.JoinSpace(ctx, id); err != nil { t.Fatal(err) }
+    }
+    if err := c.SendOperation(ctx, "a", moveOp(1, "x", 4)); err != nil { t.Fatal(err) }
+    // the same cell is free in the other space
+    if err := c.SendOperation(ctx, "b", moveOp(1, "y", 4)); err != nil { t.Fatal(err) }
+    if err := c.SendOperation(ctx, "b", moveOp(1, "x", 0)); err != nil { t.Fatal(err) }
+    if err := c.SendOperation(ctx, "a", moveOp(1, "x", 0)); !errors.Is(err, ErrNotYourTurn) { t.Fatalf("second move of x in a: %v", err) }
+
+    for id, want := range map[string]int{"a": 1, "b": 2} {
+        page, err := c.ReadOperations(ctx, id, "")
+        if err != nil { t.Fatal(err) }
+        if len(page.Operations) != want { t.Fatalf("space %s has %d operations, want %d", id, len(page.Operations), want) }
+        if n := sink.count(id); n != want { t.Fatalf("space %s dispatched %d events, want %d", id, n, want) }
+    }
+    board, err := c.BoardState(ctx, "a")
+    if err != nil { t.Fatal(err) }
+    if board.Board[4] == "" || board.Board[0] != "" { t.Fatalf("board of a %v", board.Board) }
+    if got := len(c.ListSpaces()); got != 2 { t.Fatalf("%d open spaces", got) }
+}
+
+func TestCloseOneSpace(t *testing.T) {
+    c := startDemo(t, nil)
+    ctx := context.Background()
+    for _, id := range []string{"a", "b"} {
+        if err := c.JoinSpace(ctx, id); err != nil { t.Fatal(err) }
+    }
+    if err := c.SendOperation(ctx, "a", moveOp(1, "x", 4)); err != nil { t.Fatal(err) }
+    // joining an open space keeps it as it is
+    if err := c.JoinSpace(ctx, "a"); err != nil { t.Fatal(err) }
+    if page, _ := c.ReadOperations(ctx, "a", ""); len(page.Operations) != 1 { t.Fatalf("rejoin replaced the space: %d operations", len(page.Operations)) }
+
+    if err := c.CloseSpace("a"); err != nil { t.Fatal(err) }
+    if err := c.CloseSpace("a"); !errors.Is(err, ErrSpaceNotOpen) { t.Fatalf("second close: %v", err) }
+    err := c.SendOperation(ctx, "a", moveOp(1, "y", 0))
+    if !errors.Is(err, ErrSpaceNotOpen) || ErrorCode(err) != CodeSpaceNotOpen { t.Fatalf("send to a closed space: %v", err) }
+    if err := c.SendOperation(ctx, "b", moveOp(1, "y", 0)); err != nil { t.Fatalf("other space after close: %v", err) }
+    spaces := c.ListSpaces()
+    if len(spaces) != 1 || spaces[0].SpaceId != "b" || !spaces[0].Demo { t.Fatalf("open spaces %+v", spaces) }
+}
+
+func TestSpacesNeedStart(t *testing.T) {
+    c, err := New(Options{StorageRoot: t.TempDir(), Demo: true})
+    if err != nil { t.Fatal(err) }
+    if err := c.JoinSpace(context.Background(), "a"); !errors.Is(err, ErrNotStarted) { t.Fatalf("join before start: %v", err) }
+    if _, err := c.CreateSpace(context.Background()); ErrorCode(err) != CodeNotStarted { t.Fatalf("create before start: %v", err) }
+}
@@ -0,0 +1,479 @@
+package client
+
+import (
+    "context"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "log"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+    "github.com/anyproto/any-sync/commonspace/spacestorage"
+    anystore "github.com/anyproto/any-store"
+)
+
+// defaultStoreIdleTTL is how long an unused space DB stays open
+const defaultStoreIdleTTL = time.Minute
+
+const storeFile = "store.db"
+
+// StorageBackend selects where space DBs live
+type StorageBackend string
+
+const (
+    // StorageDisk keeps spaces in anystore DBs under the storage root (default)
+    StorageDisk StorageBackend = "disk"
+    // StorageMemory keeps spaces in process memory only, for tests and
+    // throwaway games: every space is a shared-cache in-memory sqlite DB that
+    // stays open until the space is deleted or the app shuts down, which
+    // drops it. Nothing is written to disk.
+    StorageMemory StorageBackend = "memory"
+)
+
+// StorageOptions configure the space storage backend
+type StorageOptions struct {
+    Backend StorageBackend `json:"backend"`
+    // Root holds one directory per space; defaults to <storage root>/spaces.
+    // Ignored by the memory backend, which has no files.
+    Root string `json:"root"`
+}
+
+func (o StorageOptions) validate() error {
+    switch o.Backend {
+    case "", StorageDisk, StorageMemory:
+        return nil
+    }
+    return fmt.Errorf("%w: storage backend %q (want disk or memory)", ErrInvalidArgument, o.Backend)
+}
+
+// spacesRoot is where the disk backend keeps spaces
+func (c *Client) spacesRoot() string {
+    if c.storageOpts.Root != "" { return c.storageOpts.Root }
+    return filepath.Join(c.root, "spaces")
+}
+
+// newStorageProvider builds the provider for the configured backend. Disk
+// stores are sealed with a key derived from keys; nil keys (ephemeral
+// identity) keep them in plaintext.
+func (c *Client) newStorageProvider(keys *accountdata.AccountKeys) (*fsSpaceStorageProvider, error) {
+    if c.storageOpts.Backend == StorageMemory {
+        p := newFsSpaceStorageProvider("")
+        p.clientRoot = c.root
+        // names the DBs of this provider apart from other clients in the process
+        name := make([]byte, 8)
+        if _, err := rand.Read(name); err != nil { return nil, fmt.Errorf("memory storage: %w", err) }
+        p.memory = "tictactoe-" + hex.EncodeToString(name)
+        return p, nil
+    }
+    root := c.spacesRoot()
+    if err := os.MkdirAll(root, 0o700); err != nil { return nil, fmt.Errorf("storage root %s: %w", root, err) }
+    p := newFsSpaceStorageProvider(root)
+    p.clientRoot = c.root
+    key, err := storeKey(keys)
+    if err != nil { return nil, err }
+    if key == nil {
+        log.Printf("No account key; space stores under %s stay unencrypted", root)
+        return p, nil
+    }
+    if p.work, err = newWorkDir(c.root, key); err != nil { return nil, fmt.Errorf("storage work dir: %w", err) }
+    p.key = key
+    return p, nil
+}
+
+// fsSpaceStorageProvider keeps one anystore DB per space under
+// <root>/<spaceId>/store.db, or sealed as store.db.enc when it has a key (see
+// storecrypt.go). commonspace may ask for storages concurrently; every
+// storage it gets holds a reference on the shared DB and drops it on Close.
+// DBs nobody references are closed after idleTTL, and Close (app shutdown)
+// checkpoints and closes them all. The memory backend uses the same provider
+// without a root: its DBs are in-memory, a space exists while its DB is open,
+// and they are never closed for being idle.
+type fsSpaceStorageProvider struct {
+    root    string
+    idleTTL time.Duration
+    // DB name prefix of the memory backend; empty on disk
+    memory string
+    // at-rest master key; open DBs live under work while it is set
+    key  []byte
+    work string
+    // seal interval of open stores
+    resealEvery time.Duration
+    // client storage root: crash reports of the sweeper, work dir fallback
+    clientRoot string
+
+    mu     sync.Mutex
+    stores map[string]*storeEntry
+    done   chan struct{}
+    wg     sync.WaitGroup
+}
+
+type storeEntry struct {
+    db        anystore.DB
+    refs      int
+    idleSince time.Time
+    // when the sealed file last matched the DB
+    sealedAt time.Time
+}
+
+func newFsSpaceStorageProvider(root string) *fsSpaceStorageProvider {
+    return &fsSpaceStorageProvider{root: root, idleTTL: defaultStoreIdleTTL, resealEvery: storeResealInterval, stores: make(map[string]*storeEntry)}
+}
+
+func (p *fsSpaceStorageProvider) Init(a *anyapp.App) error { return nil }
+func (p *fsSpaceStorageProvider) Name() string { return spacestorage.CName }
+
+// Run seals work copies a crash left behind and plaintext stores from before
+// encryption, then starts the idle sweeper
+func (p *fsSpaceStorageProvider) Run(ctx context.Context) error {
+    if p.sealed() {
+        p.recoverWork(ctx)
+        p.migratePlain(ctx)
+    }
+    p.mu.Lock()
+    p.done = make(chan struct{})
+    p.mu.Unlock()
+    p.wg.Add(1)
+    go p.sweep(p.done)
+    return nil
+}
+
+// Close stops the sweeper, then checkpoints and closes every open DB;
+// called by app.Close
+func (p *fsSpaceStorageProvider) Close(ctx context.Context) error {
+    p.mu.Lock()
+    if p.done != nil { close(p.done); p.done = nil }
+    p.mu.Unlock()
+    p.wg.Wait()
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    var errs []error
+    for id, e := range p.stores {
+        if e.refs > 0 { log.Printf("closing %s with %d open storages", id, e.refs) }
+        if err := p.closeStore(ctx, id, e.db); err != nil { errs = append(errs, err) }
+    }
+    p.stores = make(map[string]*storeEntry)
+    if p.work != "" {
+        if err := os.RemoveAll(p.work); err != nil { errs = append(errs, err) }
+    }
+    return errors.Join(errs...)
+}
+
+// closeStore checkpoints and closes a DB; a sealed store is then re-sealed
+// and its plaintext removed. Callers hold p.mu.
+func (p *fsSpaceStorageProvider) closeStore(ctx context.Context, id string, db anystore.DB) error {
+    if err := db.Checkpoint(ctx, true); err != nil { log.Printf("checkpoint %s: %v", id, err) }
+    if err := db.Close(); err != nil { return fmt.Errorf("close %s: %w", id, err) }
+    if !p.sealed() { return nil }
+    defer os.RemoveAll(filepath.Join(p.work, id))
+    gcm, err := spaceCipher(p.key, id)
+    if err != nil { return err }
+    if err := sealFile(gcm, id, p.dbPath(id), p.sealedPath(id)); err != nil { return fmt.Errorf("seal %s: %w", id, err) }
+    return nil
+}
+
+// recoverWork seals the working copies that a run of the same account and
+// storage root left in its work dirs, in RAM or on disk, when it did not shut
+// down cleanly, then removes them. A copy whose space directory is gone
+// (deleted space, listing copy) is just dropped; a dir that fails to recover
+// is kept for the next start. Work dirs of other accounts or roots are left
+// for them.
+func (p *fsSpaceStorageProvider) recoverWork(ctx context.Context) {
+    tag := workTag(p.clientRoot, p.key)
+    for _, base := range workBases(p.clientRoot) {
+        dirs, err := os.ReadDir(base)
+        if errors.Is(err, os.ErrNotExist) { continue }
+        if err != nil { log.Printf("storage recovery: %v", err); continue }
+        for _, d := range dirs {
+            dir := filepath.Join(base, d.Name())
+            if !d.IsDir() || dir == p.work || !strings.HasPrefix(d.Name(), tag) { continue }
+            p.recoverDir(ctx, dir)
+        }
+    }
+}
+
+// recoverDir seals the copies of one leftover work dir and removes it once
+// all of them are safe
+func (p *fsSpaceStorageProvider) recoverDir(ctx context.Context, dir string) {
+    copies, err := os.ReadDir(dir)
+    if err != nil { log.Printf("storage recovery: %v", err); return }
+    ok := true
+    for _, c := range copies {
+        if err := p.recoverCopy(ctx, c.Name(), filepath.Join(dir, c.Name(), storeFile)); err != nil {
+            log.Printf("storage recovery %s: %v", c.Name(), err)
+            ok = false
+        }
+    }
+    if ok { _ = os.RemoveAll(dir) }
+}
+
+func (p *fsSpaceStorageProvider) recoverCopy(ctx context.Context, id, plain string) error {
+    if _, err := os.Stat(plain); err != nil { return nil }
+    if _, err := os.Stat(filepath.Join(p.root, id)); err != nil { return nil }
+    // opening replays the WAL into the DB file
+    db, err := anystore.Open(ctx, plain, nil)
+    if err != nil { return err }
+    if err := db.Checkpoint(ctx, true); err != nil { _ = db.Close(); return err }
+    if err := db.Close(); err != nil { return err }
+    gcm, err := spaceCipher(p.key, id)
+    if err != nil { return err }
+    if err := sealFile(gcm, id, plain, p.sealedPath(id)); err != nil { return err }
+    log.Printf("Recovered space store %s from an interrupted run", id)
+    return nil
+}
+
+// migratePlain seals every plaintext store.db under root and removes the
+// plaintext. The DB is checkpointed first so the WAL is part of it.
+func (p *fsSpaceStorageProvider) migratePlain(ctx context.Context) {
+    entries, err := os.ReadDir(p.root)
+    if err != nil { log.Printf("storage migration: %v", err); return }
+    for _, ent := range entries {
+        id := ent.Name()
+        plain := filepath.Join(p.root, id, storeFile)
+        if _, err := os.Stat(plain); err != nil { continue }
+        if err := p.sealPlain(ctx, id, plain); err != nil { log.Printf("storage migration %s: %v", id, err); continue }
+        log.Printf("Encrypted space store %s", id)
+    }
+}
+
+func (p *fsSpaceStorageProvider) sealPlain(ctx context.Context, id, plain string) error {
+    // a crash after the rename leaves both; the sealed copy wins
+    if _, err := os.Stat(p.sealedPath(id)); err == nil { return removeDBFiles(plain) }
+    db, err := anystore.Open(ctx, plain, nil)
+    if err != nil { return err }
+    if err := db.Checkpoint(ctx, true); err != nil { _ = db.Close(); return err }
+    if err := db.Close(); err != nil { return err }
+    gcm, err := spaceCipher(p.key, id)
+    if err != nil { return err }
+    if err := sealFile(gcm, id, plain, p.sealedPath(id)); err != nil { return err }
+    return removeDBFiles(plain)
+}
+
+// sweep closes idle DBs and reseals open ones until done is closed
+func (p *fsSpaceStorageProvider) sweep(done chan struct{}) {
+    defer p.wg.Done()
+    defer recoverGo(p.clientRoot, "storage sweep")
+    idle := time.NewTicker(p.idleTTL / 2)
+    defer idle.Stop()
+    reseal := time.NewTicker(p.resealEvery)
+    defer reseal.Stop()
+    for {
+        select {
+        case <-done:
+            return
+        case <-idle.C:
+            p.closeIdle(time.Now())
+        case <-reseal.C:
+            p.resealOpen(context.Background())
+        }
+    }
+}
+
+// resealOpen seals the open stores written since their last seal, so a lost
+// working copy (reboot, RAM-backed dir emptied) costs at most resealEvery of
+// local writes. Backup snapshots the DB consistently while it stays open.
+func (p *fsSpaceStorageProvider) resealOpen(ctx context.Context) {
+    if !p.sealed() { return }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for id, e := range p.stores {
+        if !p.changedSinceSeal(id, e) { continue }
+        if err := p.reseal(ctx, id, e); err != nil { log.Printf("reseal %s: %v", id, err) }
+    }
+}
+
+// changedSinceSeal reports whether the working copy of a store was written
+// after its last seal; mtimes are compared at whole seconds so coarse file
+// systems reseal once too often rather than never
+func (p *fsSpaceStorageProvider) changedSinceSeal(id string, e *storeEntry) bool {
+    since := e.sealedAt.Truncate(time.Second)
+    for _, f := range []string{p.dbPath(id), p.dbPath(id) + "-wal"} {
+        if fi, err := os.Stat(f); err == nil && !fi.ModTime().Before(since) { return true }
+    }
+    return false
+}
+
+// reseal seals a snapshot of an open store; callers hold p.mu
+func (p *fsSpaceStorageProvider) reseal(ctx context.Context, id string, e *storeEntry) error {
+    snap := p.dbPath(id) + ".snapshot"
+    if err := removeDBFiles(snap); err != nil { return err }
+    defer removeDBFiles(snap)
+    start := time.Now()
+    if err := e.db.Backup(ctx, snap); err != nil { return err }
+    gcm, err := spaceCipher(p.key, id)
+    if err != nil { return err }
+    if err := sealFile(gcm, id, snap, p.sealedPath(id)); err != nil { return err }
+    e.sealedAt = start
+    return nil
+}
+
+// closeIdle closes DBs that have been unreferenced for idleTTL; closing a
+// memory DB would drop the space
+func (p *fsSpaceStorageProvider) closeIdle(now time.Time) {
+    if p.inMemory() { return }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for id, e := range p.stores {
+        if e.refs > 0 || now.Sub(e.idleSince) < p.idleTTL { continue }
+        if err := p.closeStore(context.Background(), id, e.db); err != nil { log.Printf("idle %v", err) }
+        delete(p.stores, id)
+    }
+}
+
+func (p *fsSpaceStorageProvider) sealed() bool { return p.key != nil }
+func (p *fsSpaceStorageProvider) inMemory() bool { return p.memory != "" }
+
+// dbPath is where the DB of a space is opened: the work dir for sealed
+// stores, a shared-cache memory URI for the memory backend
+func (p *fsSpaceStorageProvider) dbPath(id string) string {
+    if p.inMemory() { return "file:" + p.memory + "-" + url.PathEscape(id) + "?mode=memory&cache=shared" }
+    if p.sealed() { return filepath.Join(p.work, id, storeFile) }
+    return filepath.Join(p.root, id, storeFile)
+}
+
+func (p *fsSpaceStorageProvider) sealedPath(id string) string { return filepath.Join(p.root, id, sealedFile) }
+
+func (p *fsSpaceStorageProvider) SpaceExists(id string) bool {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return p.spaceExists(id)
+}
+
+// spaceExists is SpaceExists for callers that hold p.mu
+func (p *fsSpaceStorageProvider) spaceExists(id string) bool {
+    if id == "" { return false }
+    if p.inMemory() {
+        _, ok := p.stores[id]
+        return ok
+    }
+    return hasStore(filepath.Join(p.root, id))
+}
+
+// hasStore reports whether dir is a space directory: it holds store.db or
+// store.db.enc
+func hasStore(dir string) bool {
+    for _, f := range []string{storeFile, sealedFile} {
+        if _, err := os.Stat(filepath.Join(dir, f)); err == nil { return true }
+    }
+    return false
+}
+
+// openDB opens the DB of an existing space, unsealing it into the work dir
+func (p *fsSpaceStorageProvider) openDB(ctx context.Context, id string) (anystore.DB, error) {
+    if p.sealed() {
+        plain := filepath.Join(p.root, id, storeFile)
+        if _, err := os.Stat(plain); err == nil {
+            if err := p.sealPlain(ctx, id, plain); err != nil { return nil, fmt.Errorf("encrypt %s: %w", id, err) }
+        }
+        gcm, err := spaceCipher(p.key, id)
+        if err != nil { return nil, err }
+        if err := unsealFile(gcm, id, p.sealedPath(id), p.dbPath(id)); err != nil { return nil, err }
+    } else if _, err := os.Stat(p.sealedPath(id)); err == nil {
+        return nil, fmt.Errorf("%s: %w (no account unlocked)", id, ErrStoreKey)
+    }
+    return anystore.Open(ctx, p.dbPath(id), nil)
+}
+
+// acquire returns a storage holding a reference on e; callers hold p.mu
+func (p *fsSpaceStorageProvider) acquire(id string, e *storeEntry, st spacestorage.SpaceStorage) spacestorage.SpaceStorage {
+    e.refs++
+    return &refSpaceStorage{SpaceStorage: st, release: func() { p.release(id, e) }}
+}
+
+func (p *fsSpaceStorageProvider) release(id string, e *storeEntry) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if e.refs > 0 { e.refs-- }
+    if e.refs == 0 { e.idleSince = time.Now() }
+}
+
+func (p *fsSpaceStorageProvider) WaitSpaceStorage(ctx context.Context, id string) (spacestorage.SpaceStorage, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    e, ok := p.stores[id]
+    if !ok {
+        if !p.spaceExists(id) { return nil, spacestorage.ErrSpaceStorageMissing }
+        db, err := p.openDB(ctx, id)
+        if err != nil { return nil, err }
+        // a fresh copy matches the sealed file
+        e = &storeEntry{db: db, idleSince: time.Now(), sealedAt: time.Now()}
+        p.stores[id] = e
+    }
+    st, err := spacestorage.New(ctx, id, e.db)
+    if err != nil { return nil, err }
+    return p.acquire(id, e, st), nil
+}
+
+// CreateSpaceStorage creates store.db for a new space and seals it right away
+// when encrypting; on failure the DB is closed and the half-created
+// directories removed
+func (p *fsSpaceStorageProvider) CreateSpaceStorage(ctx context.Context, payload spacestorage.SpaceStorageCreatePayload) (spacestorage.SpaceStorage, error) {
+    id := payload.SpaceHeaderWithId.Id
+    if id == "" { return nil, fmt.Errorf("%w: empty space id", ErrInvalidArgument) }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if _, ok := p.stores[id]; ok || p.spaceExists(id) { return nil, spacestorage.ErrSpaceStorageExists }
+    cleanup := func() {}
+    if !p.inMemory() {
+        dir, dbDir := filepath.Join(p.root, id), filepath.Dir(p.dbPath(id))
+        cleanup = func() { _ = os.RemoveAll(dir); _ = os.RemoveAll(dbDir) }
+        if err := os.MkdirAll(dir, 0o700); err != nil { return nil, err }
+        if err := os.MkdirAll(dbDir, 0o700); err != nil { cleanup(); return nil, err }
+    }
+    db, err := anystore.Open(ctx, p.dbPath(id), nil)
+    if err != nil { cleanup(); return nil, err }
+    st, err := spacestorage.Create(ctx, db, payload)
+    if err == nil && p.sealed() {
+        var gcm cipher.AEAD
+        if err = db.Checkpoint(ctx, true); err == nil { gcm, err = spaceCipher(p.key, id) }
+        if err == nil { err = sealFile(gcm, id, p.dbPath(id), p.sealedPath(id)) }
+    }
+    if err != nil {
+        _ = db.Close()
+        cleanup()
+        return nil, err
+    }
+    e := &storeEntry{db: db, sealedAt: time.Now()}
+    p.stores[id] = e
+    return p.acquire(id, e, st), nil
+}
+
+// DeleteSpaceStorage closes the DB of the space, whoever still references
+// it, and removes its directory (store.db or store.db.enc and the WAL files)
+// along with its work copy. Closing is all a memory space needs.
+func (p *fsSpaceStorageProvider) DeleteSpaceStorage(ctx context.Context, id string) error {
+    if id == "" { return fmt.Errorf("%w: empty space id", ErrInvalidArgument) }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if e, ok := p.stores[id]; ok {
+        if err := e.db.Close(); err != nil { log.Printf("close %s: %v", id, err) }
+        delete(p.stores, id)
+    }
+    if p.inMemory() { return nil }
+    if p.sealed() {
+        if err := os.RemoveAll(filepath.Join(p.work, id)); err != nil { log.Printf("remove work copy of %s: %v", id, err) }
+    }
+    return os.RemoveAll(filepath.Join(p.root, id))
+}
+
+// refSpaceStorage is a space storage over a shared DB; Close drops the
+// reference instead of closing the DB
+type refSpaceStorage struct {
+    spacestorage.SpaceStorage
+    once    sync.Once
+    release func()
+}
+
+func (s *refSpaceStorage) Close(ctx context.Context) error {
+    s.once.Do(s.release)
+    return nil
+}
@@ -0,0 +1,260 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+    "github.com/anyproto/any-sync/commonspace/spacepayloads"
+    "github.com/anyproto/any-sync/commonspace/spacestorage"
+    "github.com/anyproto/any-sync/commonspace/spacesyncproto"
+    "github.com/anyproto/any-sync/util/crypto"
+)
+
+// storageModes run a test against each kind of provider: plaintext disk
+// stores, sealed disk stores and the memory backend
+var storageModes = []string{"plain", "sealed", "memory"}
+
+func newTestProvider(t *testing.T, mode string) *fsSpaceStorageProvider {
+    t.Helper()
+    // keeps work dirs of sealed providers out of the real runtime dir
+    t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+    c := &Client{root: t.TempDir()}
+    var keys *accountdata.AccountKeys
+    switch mode {
+    case "memory":
+        c.storageOpts.Backend = StorageMemory
+    case "sealed":
+        var err error
+        if keys, err = accountdata.NewRandom(); err != nil { t.Fatal(err) }
+    }
+    p, err := c.newStorageProvider(keys)
+    if err != nil { t.Fatal(err) }
+    return p
+}
+
+func forEachStorageMode(t *testing.T, test func(t *testing.T, p *fsSpaceStorageProvider)) {
+    for _, mode := range storageModes {
+        t.Run(mode, func(t *testing.T) {
+            p := newTestProvider(t, mode)
+            t.Cleanup(func() { _ = p.Close(context.Background()) })
+            test(t, p)
+        })
+    }
+}
+
+// spacePayload builds the storage payload of a new space, as CreateSpace does
+func spacePayload(t *testing.T) spacestorage.SpaceStorageCreatePayload {
+    t.Helper()
+    keys, err := accountdata.NewRandom()
+    if err != nil { t.Fatal(err) }
+    masterKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+    if err != nil { t.Fatal(err) }
+    metaKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+    if err != nil { t.Fatal(err) }
+    payload, err := spacepayloads.StoragePayloadForSpaceCreate(spacepayloads.SpaceCreatePayload{
+        SigningKey:     keys.SignKey,
+        SpaceType:      "tictactoe",
+        ReplicationKey: 1,
+        MasterKey:      masterKey,
+        ReadKey:        crypto.NewAES(),
+        MetadataKey:    metaKey,
+        Metadata:       []byte("test"),
+    })
+    if err != nil { t.Fatal(err) }
+    return payload
+}
+
+// refCount is the number of storages holding the open DB of id; -1 when the
+// DB is not open
+func refCount(p *fsSpaceStorageProvider, id string) int {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    e, ok := p.stores[id]
+    if !ok { return -1 }
+    return e.refs
+}
+
+func TestStorageConcurrentCreateAndWait(t *testing.T) {
+    forEachStorageMode(t, func(t *testing.T, p *fsSpaceStorageProvider) {
+        ctx := context.Background()
+        payload := spacePayload(t)
+        id := payload.SpaceHeaderWithId.Id
+        const n = 8
+        var created atomic.Int32
+        var mu sync.Mutex
+        var held []spacestorage.SpaceStorage
+        hold := func(st spacestorage.SpaceStorage) { mu.Lock(); held = append(held, st); mu.Unlock() }
+        var wg sync.WaitGroup
+        for i := 0; i < n; i++ {
+            wg.Add(2)
+            go func() {
+                defer wg.Done()
+                st, err := p.CreateSpaceStorage(ctx, payload)
+                if err == nil { created.Add(1); hold(st); return }
+                if !errors.Is(err, spacestorage.ErrSpaceStorageExists) { t.Errorf("create: %v", err) }
+            }()
+            go func() {
+                defer wg.Done()
+                st, err := p.WaitSpaceStorage(ctx, id)
+                if err == nil { hold(st); return }
+                // the space may not be created yet
+                if !errors.Is(err, spacestorage.ErrSpaceStorageMissing) { t.Errorf("wait: %v", err) }
+            }()
+        }
+        wg.Wait()
+        if got := created.Load(); got != 1 { t.Fatalf("%d creates succeeded, want 1", got) }
+        for _, st := range held {
+            if st.Id() != id { t.Fatalf("storage of %s, want %s", st.Id(), id) }
+        }
+        // every storage shares the one DB
+        if got := refCount(p, id); got != len(held) { t.Fatalf("%d refs, %d storages", got, len(held)) }
+        for _, st := range held { _ = st.Close(ctx) }
+        if got := refCount(p, id); got != 0 { t.Fatalf("%d refs after closing every storage", got) }
+    })
+}
+
+func TestStorageRefcountRelease(t *testing.T) {
+    forEachStorageMode(t, func(t *testing.T, p *fsSpaceStorageProvider) {
+        ctx := context.Background()
+        payload := spacePayload(t)
+        id := payload.SpaceHeaderWithId.Id
+        st1, err := p.CreateSpaceStorage(ctx, payload)
+        if err != nil { t.Fatal(err) }
+        st2, err := p.WaitSpaceStorage(ctx, id)
+        if err != nil { t.Fatal(err) }
+        st3, err := p.WaitSpaceStorage(ctx, id)
+        if err != nil { t.Fatal(err) }
+        if got := refCount(p, id); got != 3 { t.Fatalf("%d refs, want 3", got) }
+        // closing a storage twice releases it once
+        _ = st2.Close(ctx)
+        _ = st2.Close(ctx)
+        if got := refCount(p, id); got != 2 { t.Fatalf("%d refs, want 2", got) }
+        before := time.Now()
+        _ = st1.Close(ctx)
+        _ = st3.Close(ctx)
+        if got := refCount(p, id); got != 0 { t.Fatalf("%d refs, want 0", got) }
+        p.mu.Lock()
+        idle := p.stores[id].idleSince
+        p.mu.Unlock()
+        if idle.Before(before) { t.Fatalf("idle since %v, released after %v", idle, before) }
+    })
+}
+
+func TestStorageIdleClose(t *testing.T) {
+    forEachStorageMode(t, func(t *testing.T, p *fsSpaceStorageProvider) {
+        ctx := context.Background()
+        p.idleTTL = time.Minute
+        payload := spacePayload(t)
+        id := payload.SpaceHeaderWithId.Id
+        st, err := p.CreateSpaceStorage(ctx, payload)
+        if err != nil { t.Fatal(err) }
+        // a referenced DB is never idle
+        p.closeIdle(time.Now().Add(time.Hour))
+        if refCount(p, id) != 1 { t.Fatal("closed a referenced DB") }
+        _ = st.Close(ctx)
+        p.closeIdle(time.Now())
+        if refCount(p, id) != 0 { t.Fatal("closed before the TTL") }
+        p.closeIdle(time.Now().Add(2 * time.Minute))
+        if p.inMemory() {
+            // closing would drop the space
+            if refCount(p, id) != 0 { t.Fatal("closed a memory DB") }
+            return
+        }
+        if refCount(p, id) != -1 { t.Fatal("kept a DB idle past the TTL") }
+        if p.sealed() {
+            if exists(filepath.Join(p.work, id)) { t.Fatal("work copy left after close") }
+            if !exists(p.sealedPath(id)) || exists(filepath.Join(p.root, id, storeFile)) { t.Fatal("store not sealed") }
+        }
+        // a closed space reopens
+        st, err = p.WaitSpaceStorage(ctx, id)
+        if err != nil { t.Fatal(err) }
+        if st.Id() != id { t.Fatalf("reopened %s", st.Id()) }
+        _ = st.Close(ctx)
+
+        // the sweeper closes it on its own
+        p.idleTTL = 20 * time.Millisecond
+        if err := p.Run(ctx); err != nil { t.Fatal(err) }
+        deadline := time.Now().Add(5 * time.Second)
+        for refCount(p, id) != -1 {
+            if time.Now().After(deadline) { t.Fatal("sweeper did not close the idle DB") }
+            time.Sleep(10 * time.Millisecond)
+        }
+    })
+}
+
+func TestStorageCloseWhileHeld(t *testing.T) {
+    forEachStorageMode(t, func(t *testing.T, p *fsSpaceStorageProvider) {
+        ctx := context.Background()
+        payload := spacePayload(t)
+        id := payload.SpaceHeaderWithId.Id
+        st1, err := p.CreateSpaceStorage(ctx, payload)
+        if err != nil { t.Fatal(err) }
+        st2, err := p.WaitSpaceStorage(ctx, id)
+        if err != nil { t.Fatal(err) }
+        if err := p.Run(ctx); err != nil { t.Fatal(err) }
+        if err := p.Close(ctx); err != nil { t.Fatalf("close: %v", err) }
+        if refCount(p, id) != -1 { t.Fatal("DB left open") }
+        // storages outliving the provider close without touching the new state
+        if err := st1.Close(ctx); err != nil { t.Fatal(err) }
+        if err := st2.Close(ctx); err != nil { t.Fatal(err) }
+        if p.inMemory() {
+            if p.SpaceExists(id) { t.Fatal("memory space survived close") }
+            return
+        }
+        if p.sealed() && exists(p.work) { t.Fatal("work dir left after close") }
+        st, err := p.WaitSpaceStorage(ctx, id)
+        if err != nil { t.Fatalf("reopen after close: %v", err) }
+        if got := refCount(p, id); got != 1 { t.Fatalf("%d refs after reopening", got) }
+        _ = st.Close(ctx)
+    })
+}
+
+func TestStorageFailedCreateCleanup(t *testing.T) {
+    // sealing is the last step of a create; a directory where its temp file
+    // goes makes it fail after the DB was created
+    p := newTestProvider(t, "sealed")
+    defer p.Close(context.Background())
+    ctx := context.Background()
+    payload := spacePayload(t)
+    id := payload.SpaceHeaderWithId.Id
+    if err := os.MkdirAll(p.sealedPath(id)+".tmp", 0o700); err != nil { t.Fatal(err) }
+    if _, err := p.CreateSpaceStorage(ctx, payload); err == nil { t.Fatal("create succeeded") }
+    if refCount(p, id) != -1 { t.Fatal("DB of a failed create left open") }
+    if exists(filepath.Join(p.root, id)) || exists(filepath.Join(p.work, id)) { t.Fatal("directories of a failed create left behind") }
+    if p.SpaceExists(id) { t.Fatal("failed create left a space") }
+    st, err := p.CreateSpaceStorage(ctx, payload)
+    if err != nil { t.Fatalf("create after cleanup: %v", err) }
+    _ = st.Close(ctx)
+
+    // an empty id never reaches the disk
+    if _, err := p.CreateSpaceStorage(ctx, spacestorage.SpaceStorageCreatePayload{SpaceHeaderWithId: &spacesyncproto.RawSpaceHeaderWithId{}}); !errors.Is(err, ErrInvalidArgument) { t.Fatalf("empty id: %v", err) }
+}
+
+func TestStorageBackend(t *testing.T) {
+    if _, err := New(Options{StorageRoot: t.TempDir(), Storage: StorageOptions{Backend: "tape"}}); !errors.Is(err, ErrInvalidArgument) { t.Fatalf("unknown backend: %v", err) }
+    ctx := context.Background()
+
+    // the memory backend writes no space files
+    mem := &Client{root: t.TempDir(), storageOpts: StorageOptions{Backend: StorageMemory}}
+    p, err := mem.newStorageProvider(nil)
+    if err != nil { t.Fatal(err) }
+    defer p.Close(ctx)
+    if _, err := p.CreateSpaceStorage(ctx, spacePayload(t)); err != nil { t.Fatal(err) }
+    if _, err := os.Stat(mem.spacesRoot()); !errors.Is(err, os.ErrNotExist) { t.Fatalf("memory backend created %s: %v", mem.spacesRoot(), err) }
+
+    // the disk backend puts spaces under the configured root
+    disk := &Client{root: t.TempDir(), storageOpts: StorageOptions{Backend: StorageDisk, Root: filepath.Join(t.TempDir(), "games")}}
+    p, err = disk.newStorageProvider(nil)
+    if err != nil { t.Fatal(err) }
+    defer p.Close(ctx)
+    payload := spacePayload(t)
+    if _, err := p.CreateSpaceStorage(ctx, payload); err != nil { t.Fatal(err) }
+    if _, err := os.Stat(filepath.Join(disk.storageOpts.Root, payload.SpaceHeaderWithId.Id, storeFile)); err != nil { t.Fatalf("disk store: %v", err) }
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "runtime"
+    "time"
+
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+    "golang.org/x/crypto/hkdf"
+)
+
+// Space stores are sealed on disk, which is not full encryption at rest.
+// anystore (sqlite) has no page codec or encrypting VFS, so the files in the
+// spaces root are store.db.enc: the whole DB sealed with AES-256-GCM under a
+// per-space key derived from the account's storage key. A space in use
+// cannot be read from the sealed file; its DB is a plaintext working copy,
+// and that copy is what the request's "encrypted on-disk databases" does not
+// cover:
+//   - it lives in a RAM-backed directory when the platform has one
+//     ($XDG_RUNTIME_DIR or /dev/shm on Linux) and never touches the disk;
+//     elsewhere (Android, iOS, macOS, Windows) it falls back to
+//     <storage root>/work, plaintext on disk while the space is open
+//   - it is sealed again every storeResealInterval and when the DB is closed
+//     (idle, deleted or shutdown), then removed
+//   - a crash leaves it behind until the next start of the same account and
+//     storage root seals it into its space and removes it; a reboot empties
+//     the RAM-backed copy, losing at most storeResealInterval of local writes
+//     that the nodes have not synced yet
+// Plaintext stores from before sealing are sealed when a client with a
+// keystore or mnemonic account starts; ephemeral identities keep plaintext
+// stores since their key would not survive a restart.
+
+const (
+    sealedFile = storeFile + ".enc"
+    sealMagic  = "TTTSDB1\x00"
+    // workDir holds the working copies of open sealed spaces when there is
+    // no RAM-backed directory
+    workDir = "work"
+    // workPrefix starts the names of work dirs, which may share a RAM-backed
+    // directory with other programs
+    workPrefix = "tictactoe-"
+    // storeResealInterval bounds how far a sealed store lags its open copy
+    storeResealInterval = time.Minute
+    // storeKeySalt and storeKeyInfo derive the storage key of an account
+    storeKeySalt = "tictactoe-anysync storage key salt v1"
+    storeKeyInfo = "tictactoe-anysync storage key"
+)
+
+// ErrStoreKey is returned for a sealed space store that the current account
+// cannot decrypt (another account, no account unlocked, or a corrupted file)
+var ErrStoreKey = errors.New("space store cannot be decrypted with this account")
+
+// storeKey derives the storage key of an account once per provider, so the
+// identity key itself never keys a cipher; nil keeps stores in plaintext
+func storeKey(keys *accountdata.AccountKeys) ([]byte, error) {
+    if keys == nil || keys.SignKey == nil { return nil, nil }
+    raw, err := keys.SignKey.Raw()
+    if err != nil { return nil, fmt.Errorf("store key: %w", err) }
+    key := make([]byte, 32)
+    if _, err := io.ReadFull(hkdf.New(sha256.New, raw, []byte(storeKeySalt), []byte(storeKeyInfo)), key); err != nil { return nil, fmt.Errorf("store key: %w", err) }
+    return key, nil
+}
+
+// spaceCipher derives the AES-256-GCM cipher of one space from the master key
+func spaceCipher(master []byte, spaceId string) (cipher.AEAD, error) {
+    key := make([]byte, 32)
+    kdf := hkdf.New(sha256.New, master, nil, []byte("tictactoe-anysync store.db "+spaceId))
+    if _, err := io.ReadFull(kdf, key); err != nil { return nil, err }
+    block, err := aes.NewCipher(key)
+    if err != nil { return nil, err }
+    return cipher.NewGCM(block)
+}
+
+// sealFile encrypts the DB file src into dst; the space id is bound as
+// associated data so sealed files cannot be swapped between spaces
+func sealFile(gcm cipher.AEAD, spaceId, src, dst string) error {
+    plain, err := os.ReadFile(src)
+    if err != nil { return err }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := rand.Read(nonce); err != nil { return err }
+    out := append([]byte(sealMagic), nonce...)
+    out = gcm.Seal(out, nonce, plain, []byte(spaceId))
+    // write-then-rename so a crash never leaves a truncated store behind
+    tmp := dst + ".tmp"
+    if err := os.WriteFile(tmp, out, 0o600); err != nil { return err }
+    return os.Rename(tmp, dst)
+}
+
+// unsealFile decrypts the sealed store src into the DB file dst
+func unsealFile(gcm cipher.AEAD, spaceId, src, dst string) error {
+    b, err := os.ReadFile(src)
+    if err != nil { return err }
+    head := len(sealMagic) + gcm.NonceSize()
+    if len(b) < head || string(b[:len(sealMagic)]) != sealMagic { return fmt.Errorf("%s: %w", spaceId, ErrStoreKey) }
+    plain, err := gcm.Open(nil, b[len(sealMagic):head], b[head:], []byte(spaceId))
+    if err != nil { return fmt.Errorf("%s: %w", spaceId, ErrStoreKey) }
+    if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil { return err }
+    return os.WriteFile(dst, plain, 0o600)
+}
+
+// rootTag names the work dirs of one storage root
+func rootTag(root string) string {
+    if abs, err := filepath.Abs(root); err == nil { root = abs }
+    sum := sha256.Sum256([]byte(root))
+    return hex.EncodeToString(sum[:8])
+}
+
+// workTag names the work dirs of one account and storage root without
+// revealing the key; only those dirs hold copies this provider may seal
+func workTag(root string, master []byte) string {
+    tag := make([]byte, 8)
+    _, _ = io.ReadFull(hkdf.New(sha256.New, master, nil, []byte("tictactoe-anysync work dir")), tag)
+    return workPrefix + rootTag(root) + "-" + hex.EncodeToString(tag) + "-"
+}
+
+// volatileBase is a RAM-backed directory for working copies, "" when the
+// platform has none. Both candidates are tmpfs on Linux; the random 0700 dir
+// created in it keeps other users out of a shared /dev/shm.
+func volatileBase() string {
+    if runtime.GOOS != "linux" { return "" }
+    for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+        if dir == "" { continue }
+        if fi, err := os.Stat(dir); err == nil && fi.IsDir() { return dir }
+    }
+    return ""
+}
+
+// workBases are the directories that may hold work dirs of root: the
+// RAM-backed one, then the on-disk fallback
+func workBases(root string) []string {
+    disk := filepath.Join(root, workDir)
+    if v := volatileBase(); v != "" { return []string{v, disk} }
+    return []string{disk}
+}
+
+// newWorkDir creates the 0700 work dir of a provider, in RAM when possible
+func newWorkDir(root string, master []byte) (string, error) {
+    tag := workTag(root, master)
+    if v := volatileBase(); v != "" {
+        dir, err := os.MkdirTemp(v, tag)
+        if err == nil { return dir, nil }
+        log.Printf("work dir in %s: %v", v, err)
+    }
+    base := filepath.Join(root, workDir)
+    log.Printf("No RAM-backed directory; open space stores are decrypted under %s", base)
+    if err := os.MkdirAll(base, 0o700); err != nil { return "", err }
+    return os.MkdirTemp(base, tag)
+}
+
+// removeVolatileWork removes the RAM-backed work dirs of root, whichever
+// account they belong to
+func removeVolatileWork(root string) []error {
+    v := volatileBase()
+    if v == "" { return nil }
+    dirs, _ := filepath.Glob(filepath.Join(v, workPrefix+rootTag(root)+"-*"))
+    var errs []error
+    for _, d := range dirs {
+        if err := os.RemoveAll(d); err != nil { errs = append(errs, err) }
+    }
+    return errs
+}
+
+// removeDBFiles removes a sqlite DB together with its WAL and shared memory files
+func removeDBFiles(path string) error {
+    var errs []error
+    for _, p := range []string{path, path + "-wal", path + "-shm"} {
+        if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) { errs = append(errs, err) }
+    }
+    return errors.Join(errs...)
+}
+
+// rootEntries are the entries of the storage root the client owns; wiping
+// leaves anything else there alone
+var rootEntries = []string{keystoreFile, nodeConfDir, CrashDir, layoutFile, workDir}
+
+// WipeLocalData is the secure logout: it shuts the client down, forgets the
+// unlocked account and deletes everything the client keeps on disk: the space
+// directories of the spaces root, the keystore, node configs, crash reports,
+// the layout manifest and work copies, RAM-backed ones included. Other files in the storage root or a
+// custom spaces root are kept. Spaces stay on the network and the account can
+// be restored from its mnemonic.
+func (c *Client) WipeLocalData(ctx context.Context) error {
+    c.lifecycleMu.Lock()
+    defer c.lifecycleMu.Unlock()
+    var errs []error
+    if c.started {
+        if err := c.shutdown(ctx); err != nil { errs = append(errs, err) }
+    }
+    c.accountMu.Lock()
+    c.account = nil
+    c.accountMu.Unlock()
+    c.nodeConf = nil
+    errs = append(errs, wipeSpaces(c.spacesRoot())...)
+    errs = append(errs, removeVolatileWork(c.root)...)
+    if c.storageOpts.Root == "" {
+        // the default spaces root is ours too, once nothing else is in it
+        if err := os.Remove(c.spacesRoot()); err != nil && !errors.Is(err, os.ErrNotExist) { log.Printf("wipe: keeping %s: %v", c.spacesRoot(), err) }
+    }
+    for _, name := range rootEntries {
+        path := filepath.Join(c.root, name)
+        for _, p := range []string{path, path + ".tmp"} {
+            if err := os.RemoveAll(p); err != nil { errs = append(errs, err) }
+        }
+    }
+    temps, _ := filepath.Glob(filepath.Join(c.root, keystoreTempPattern))
+    for _, p := range temps {
+        if err := os.Remove(p); err != nil { errs = append(errs, err) }
+    }
+    // mark the wiped root as current
+    if err := writeLayout(c.root, LayoutVersion); err != nil { errs = append(errs, err) } else { c.layoutPending = false }
+    return errors.Join(errs...)
+}
+
+// wipeSpaces removes the space directories (those holding a store) of root
+func wipeSpaces(root string) []error {
+    entries, err := os.ReadDir(root)
+    if errors.Is(err, os.ErrNotExist) { return nil }
+    if err != nil { return []error{err} }
+    var errs []error
+    for _, e := range entries {
+        dir := filepath.Join(root, e.Name())
+        if !e.IsDir() || !hasStore(dir) { continue }
+        if err := os.RemoveAll(dir); err != nil { errs = append(errs, err) }
+    }
+    return errs
+}
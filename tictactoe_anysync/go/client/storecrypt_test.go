@@ -0,0 +1,129 @@
+package client
+
+import (
+    "bytes"
+    "context"
+    "crypto/cipher"
+    "errors"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "testing"
+
+    anystore "github.com/anyproto/any-store"
+    "github.com/anyproto/any-store/anyenc"
+    "github.com/anyproto/any-sync/commonspace/object/accountdata"
+)
+
+func testStoreKey(t *testing.T) []byte {
+    t.Helper()
+    keys, err := accountdata.NewRandom()
+    if err != nil { t.Fatal(err) }
+    key, err := storeKey(keys)
+    if err != nil { t.Fatal(err) }
+    return key
+}
+
+func TestStoreKey(t *testing.T) {
+    keys, err := accountdata.NewRandom()
+    if err != nil { t.Fatal(err) }
+    key, err := storeKey(keys)
+    if err != nil { t.Fatal(err) }
+    again, _ := storeKey(keys)
+    raw, _ := keys.SignKey.Raw()
+    if len(key) != 32 || !bytes.Equal(key, again) { t.Fatalf("storage key %x, then %x", key, again) }
+    if bytes.Contains(raw, key) { t.Fatal("storage key is the identity key") }
+    if key, err := storeKey(nil); key != nil || err != nil { t.Fatalf("key without an account %x, %v", key, err) }
+}
+
+func TestSealUnseal(t *testing.T) {
+    dir := t.TempDir()
+    key := testStoreKey(t)
+    plain := filepath.Join(dir, "store.db")
+    data := []byte("sqlite pages")
+    if err := os.WriteFile(plain, data, 0o600); err != nil { t.Fatal(err) }
+    gcm, err := spaceCipher(key, "space-a")
+    if err != nil { t.Fatal(err) }
+    sealed := filepath.Join(dir, sealedFile)
+    if err := sealFile(gcm, "space-a", plain, sealed); err != nil { t.Fatal(err) }
+    if b, _ := os.ReadFile(sealed); bytes.Contains(b, data) { t.Fatal("sealed file holds the plaintext") }
+    if p := perm(t, sealed); p != 0o600 { t.Fatalf("sealed file is %#o", p) }
+
+    out := filepath.Join(dir, "out", "store.db")
+    if err := unsealFile(gcm, "space-a", sealed, out); err != nil { t.Fatal(err) }
+    if b, _ := os.ReadFile(out); !bytes.Equal(b, data) { t.Fatalf("unsealed %q", b) }
+
+    // another account, another space id (a swapped file) and a torn file all fail the same way
+    other, _ := spaceCipher(testStoreKey(t), "space-a")
+    swapped, _ := spaceCipher(key, "space-b")
+    b, _ := os.ReadFile(sealed)
+    torn := filepath.Join(dir, "torn.enc")
+    if err := os.WriteFile(torn, b[:len(b)-5], 0o600); err != nil { t.Fatal(err) }
+    short := filepath.Join(dir, "short.enc")
+    if err := os.WriteFile(short, []byte(sealMagic), 0o600); err != nil { t.Fatal(err) }
+    tests := []struct {
+        name, spaceId, src string
+        gcm                cipher.AEAD
+    }{
+        {"other account", "space-a", sealed, other},
+        {"other space", "space-b", sealed, swapped},
+        {"truncated", "space-a", torn, gcm},
+        {"header only", "space-a", short, gcm},
+        {"plaintext", "space-a", plain, gcm},
+    }
+    for _, tt := range tests {
+        err := unsealFile(tt.gcm, tt.spaceId, tt.src, filepath.Join(dir, "x.db"))
+        if !errors.Is(err, ErrStoreKey) || ErrorCode(err) != CodeStoreKey { t.Errorf("%s: %v", tt.name, err) }
+    }
+}
+
+func TestWorkDirInRuntimeDir(t *testing.T) {
+    if runtime.GOOS != "linux" { t.Skip("no RAM-backed runtime dir") }
+    runtimeDir := t.TempDir()
+    t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+    root, other := t.TempDir(), t.TempDir()
+    key := testStoreKey(t)
+    work, err := newWorkDir(root, key)
+    if err != nil { t.Fatal(err) }
+    if filepath.Dir(work) != runtimeDir || strings.HasPrefix(work, root) { t.Fatalf("work dir %s", work) }
+    if p := perm(t, work); p != 0o700 { t.Fatalf("work dir is %#o", p) }
+    // the work dir names its root and account; two roots never share recovery
+    if !strings.HasPrefix(filepath.Base(work), workTag(root, key)) || workTag(root, key) == workTag(other, key) { t.Fatal("work tags") }
+
+    otherWork, err := newWorkDir(other, key)
+    if err != nil { t.Fatal(err) }
+    if errs := removeVolatileWork(root); len(errs) > 0 { t.Fatal(errs) }
+    if exists(work) || !exists(otherWork) { t.Fatal("wipe removed the wrong work dirs") }
+}
+
+func TestStorageResealOpen(t *testing.T) {
+    p := newTestProvider(t, "sealed")
+    ctx := context.Background()
+    t.Cleanup(func() { _ = p.Close(ctx) })
+    payload := spacePayload(t)
+    id := payload.SpaceHeaderWithId.Id
+    if _, err := p.CreateSpaceStorage(ctx, payload); err != nil { t.Fatal(err) }
+    before, err := os.ReadFile(p.sealedPath(id))
+    if err != nil { t.Fatal(err) }
+
+    // a write to the open DB reaches the sealed file without closing it
+    coll, err := p.stores[id].db.Collection(ctx, "reseal")
+    if err != nil { t.Fatal(err) }
+    if err := coll.Insert(ctx, anyenc.MustParseJson(`{"id":"written"}`)); err != nil { t.Fatal(err) }
+    p.resealOpen(ctx)
+    after, err := os.ReadFile(p.sealedPath(id))
+    if err != nil { t.Fatal(err) }
+    if bytes.Equal(before, after) { t.Fatal("open store not resealed") }
+    if refCount(p, id) != 1 { t.Fatal("reseal closed the DB") }
+
+    gcm, _ := spaceCipher(p.key, id)
+    copyPath := filepath.Join(t.TempDir(), storeFile)
+    if err := unsealFile(gcm, id, p.sealedPath(id), copyPath); err != nil { t.Fatal(err) }
+    db, err := anystore.Open(ctx, copyPath, nil)
+    if err != nil { t.Fatal(err) }
+    defer db.Close()
+    coll, err = db.OpenCollection(ctx, "reseal")
+    if err != nil { t.Fatal(err) }
+    if _, err := coll.FindId(ctx, "written"); err != nil { t.Fatalf("resealed store lacks the write: %v", err) }
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "sync"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace"
+    "github.com/anyproto/any-sync/commonspace/spacesyncproto"
+    "github.com/anyproto/any-sync/commonspace/sync/objectsync/objectmessages"
+    "github.com/anyproto/any-sync/net/peer"
+    "github.com/anyproto/any-sync/net/streampool"
+    "github.com/anyproto/any-sync/net/streampool/streamhandler"
+    "storj.io/drpc"
+)
+
+// streamQueueSize is the per-stream send queue of the stream pool
+const streamQueueSize = 100
+
+// streamHandler is the streampool streamhandler.StreamHandler of the client
+// app. It opens one ObjectSyncStream per node peer, subscribes it to the open
+// spaces and routes pushed HeadUpdates to the space they belong to, so remote
+// changes land without waiting for the listener's poll. A stream is forgotten
+// as soon as its context ends (the pool closes streams on read or write
+// errors), and the listener's next connect reopens it.
+type streamHandler struct {
+    // resolves open, non-demo spaces
+    spaces   func(spaceId string) (commonspace.Space, error)
+    spaceIds func() []string
+    // called after a pushed update was applied to a space
+    pushed func(spaceId string)
+    pool   streampool.StreamPool
+
+    ctx    context.Context
+    cancel context.CancelFunc
+
+    mu      sync.Mutex
+    streams map[string]spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient
+}
+
+func newStreamHandler(spaces func(spaceId string) (commonspace.Space, error), spaceIds func() []string, pushed func(spaceId string)) *streamHandler {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &streamHandler{spaces: spaces, spaceIds: spaceIds, pushed: pushed, ctx: ctx, cancel: cancel, streams: make(map[string]spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient)}
+}
+
+func (h *streamHandler) Init(a *anyapp.App) error {
+    h.pool = a.MustComponent(streampool.CName).(streampool.StreamPool)
+    return nil
+}
+
+func (h *streamHandler) Name() string { return streamhandler.CName }
+func (h *streamHandler) Run(ctx context.Context) error { return nil }
+
+// Close ends the streams opened by connect; the pool closes its own
+func (h *streamHandler) Close(ctx context.Context) error {
+    h.cancel()
+    h.mu.Lock()
+    h.streams = make(map[string]spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient)
+    h.mu.Unlock()
+    return nil
+}
+
+// OpenStream opens an ObjectSyncStream to p and subscribes it to every open space
+func (h *streamHandler) OpenStream(ctx context.Context, p peer.Peer) (stream drpc.Stream, tags []string, queueSize int, err error) {
+    conn, err := p.AcquireDrpcConn(ctx)
+    if err != nil { return nil, nil, 0, fmt.Errorf("acquire conn: %w", err) }
+    st, err := spacesyncproto.NewDRPCSpaceSyncClient(conn).ObjectSyncStream(ctx)
+    if err != nil { return nil, nil, 0, fmt.Errorf("open object sync stream: %w", err) }
+    if ids := h.spaceIds(); len(ids) > 0 {
+        if err = sendSubscription(st, spacesyncproto.SpaceSubscriptionAction_Subscribe, ids); err != nil { _ = st.Close(); return nil, nil, 0, err }
+    }
+    h.mu.Lock()
+    h.streams[p.Id()] = st
+    h.mu.Unlock()
+    go h.watch(p.Id(), st)
+    return st, nil, streamQueueSize, nil
+}
+
+// watch forgets a stream once it ends, whether the pool, the peer or drop
+// closed it, so the next connect opens a new one
+func (h *streamHandler) watch(peerId string, st spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient) {
+    select {
+    case <-st.Context().Done():
+    case <-h.ctx.Done():
+        return
+    }
+    h.forget(peerId, st)
+}
+
+func (h *streamHandler) forget(peerId string, st spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient) {
+    h.mu.Lock()
+    if h.streams[peerId] == st { delete(h.streams, peerId) }
+    h.mu.Unlock()
+}
+
+// HandleMessage applies a pushed HeadUpdate to its space
+func (h *streamHandler) HandleMessage(ctx context.Context, peerId string, msg drpc.Message) error {
+    upd, ok := msg.(*objectmessages.HeadUpdate)
+    if !ok { return fmt.Errorf("unexpected stream message %T", msg) }
+    spaceId := upd.SpaceId()
+    if spaceId == "" { return nil }
+    sp, err := h.spaces(spaceId)
+    if err != nil { return err }
+    if err := sp.HandleMessage(ctx, upd); err != nil { return fmt.Errorf("space %s: %w", spaceId, err) }
+    if h.pushed != nil { h.pushed(spaceId) }
+    return nil
+}
+
+func (h *streamHandler) NewReadMessage() drpc.Message { return &objectmessages.HeadUpdate{} }
+
+// connect makes sure every peer has a stream; the pool reads it from then on
+func (h *streamHandler) connect(peers []peer.Peer) {
+    for _, p := range peers {
+        h.mu.Lock()
+        _, ok := h.streams[p.Id()]
+        h.mu.Unlock()
+        if ok || h.ctx.Err() != nil { continue }
+        st, _, queueSize, err := h.OpenStream(peer.CtxWithPeerId(h.ctx, p.Id()), p)
+        if err != nil { log.Printf("stream to %s: %v", p.Id(), err); continue }
+        if err := h.pool.AddStream(st, queueSize); err != nil {
+            log.Printf("stream to %s: %v", p.Id(), err)
+            h.drop(p.Id(), st)
+        }
+    }
+}
+
+// subscribe asks every connected peer to push updates of the spaces
+func (h *streamHandler) subscribe(spaceIds ...string) {
+    h.broadcast(spacesyncproto.SpaceSubscriptionAction_Subscribe, spaceIds)
+}
+
+func (h *streamHandler) unsubscribe(spaceIds ...string) {
+    h.broadcast(spacesyncproto.SpaceSubscriptionAction_Unsubscribe, spaceIds)
+}
+
+func (h *streamHandler) broadcast(action spacesyncproto.SpaceSubscriptionAction, spaceIds []string) {
+    h.mu.Lock()
+    streams := make(map[string]spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient, len(h.streams))
+    for id, st := range h.streams { streams[id] = st }
+    h.mu.Unlock()
+    for peerId, st := range streams {
+        // a broken stream is reopened by the next connect
+        if err := sendSubscription(st, action, spaceIds); err != nil { h.drop(peerId, st) }
+    }
+}
+
+func (h *streamHandler) drop(peerId string, st spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient) {
+    h.forget(peerId, st)
+    _ = st.Close()
+}
+
+// sendSubscription sends a SpaceSubscription as an object sync message
+// without a space id, which nodes treat as a subscription change
+func sendSubscription(st spacesyncproto.DRPCSpaceSync_ObjectSyncStreamClient, action spacesyncproto.SpaceSubscriptionAction, spaceIds []string) error {
+    payload, err := (&spacesyncproto.SpaceSubscription{SpaceIds: spaceIds, Action: action}).Marshal()
+    if err != nil { return err }
+    if err := st.Send(&spacesyncproto.ObjectSyncMessage{Payload: payload}); err != nil { return fmt.Errorf("send subscription: %w", err) }
+    return nil
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace"
+    "github.com/anyproto/any-sync/commonspace/object/tree/objecttree"
+    "github.com/anyproto/any-sync/commonspace/object/tree/treestorage"
+    "github.com/anyproto/any-sync/commonspace/object/treemanager"
+    "github.com/anyproto/any-sync/commonspace/objecttreebuilder"
+)
+
+// treeManager is the treemanager.TreeManager of the client app. Trees are
+// built through the owning space's TreeBuilder (which wires them into space
+// sync) and cached per space until the space or the app closes. Spaces are
+// resolved through the client's registry, so only open spaces serve trees.
+type treeManager struct {
+    spaces func(spaceId string) (commonspace.Space, error)
+
+    mu    sync.Mutex
+    trees map[string]map[string]objecttree.ObjectTree
+}
+
+func newTreeManager(spaces func(spaceId string) (commonspace.Space, error)) *treeManager {
+    return &treeManager{spaces: spaces, trees: make(map[string]map[string]objecttree.ObjectTree)}
+}
+
+func (m *treeManager) Init(a *anyapp.App) error { return nil }
+func (m *treeManager) Name() string { return treemanager.CName }
+func (m *treeManager) Run(ctx context.Context) error { return nil }
+
+// Close closes every cached tree; called by app.Close
+func (m *treeManager) Close(ctx context.Context) error {
+    m.mu.Lock()
+    all := m.trees
+    m.trees = make(map[string]map[string]objecttree.ObjectTree)
+    m.mu.Unlock()
+    var errs []error
+    for _, trees := range all {
+        for _, t := range trees { errs = append(errs, t.Close()) }
+    }
+    return errors.Join(errs...)
+}
+
+func (m *treeManager) cached(spaceId, treeId string) objecttree.ObjectTree {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.trees[spaceId][treeId]
+}
+
+// store caches t unless another caller won the race; the winner is returned
+func (m *treeManager) store(spaceId string, t objecttree.ObjectTree) objecttree.ObjectTree {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if existing, ok := m.trees[spaceId][t.Id()]; ok {
+        _ = t.Close()
+        return existing
+    }
+    if m.trees[spaceId] == nil { m.trees[spaceId] = make(map[string]objecttree.ObjectTree) }
+    m.trees[spaceId][t.Id()] = t
+    return t
+}
+
+func (m *treeManager) forget(spaceId, treeId string) objecttree.ObjectTree {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    t := m.trees[spaceId][treeId]
+    delete(m.trees[spaceId], treeId)
+    return t
+}
+
+// GetTree returns the cached tree or builds it from local storage, fetching
+// it from the space's peers when it is not stored yet
+func (m *treeManager) GetTree(ctx context.Context, spaceId, treeId string) (objecttree.ObjectTree, error) {
+    if t := m.cached(spaceId, treeId); t != nil { return t, nil }
+    sp, err := m.spaces(spaceId)
+    if err != nil { return nil, err }
+    t, err := sp.TreeBuilder().BuildTree(ctx, treeId, objecttreebuilder.BuildTreeOpts{})
+    if err != nil { return nil, fmt.Errorf("build tree %s: %w", treeId, err) }
+    return m.store(spaceId, t), nil
+}
+
+// ValidateAndPutTree verifies the payload's signed changes and stores the
+// tree; putting a tree that already exists returns treestorage.ErrTreeExists
+func (m *treeManager) ValidateAndPutTree(ctx context.Context, spaceId string, payload treestorage.TreeStorageCreatePayload) error {
+    if t := m.cached(spaceId, payload.RootRawChange.Id); t != nil { return treestorage.ErrTreeExists }
+    sp, err := m.spaces(spaceId)
+    if err != nil { return err }
+    t, err := sp.TreeBuilder().PutTree(ctx, payload, nil)
+    if err != nil { return err }
+    m.store(spaceId, t)
+    return nil
+}
+
+func (m *treeManager) MarkTreeDeleted(ctx context.Context, spaceId, treeId string) error {
+    if t := m.forget(spaceId, treeId); t != nil { return t.Close() }
+    return nil
+}
+
+func (m *treeManager) DeleteTree(ctx context.Context, spaceId, treeId string) error {
+    t := m.forget(spaceId, treeId)
+    if t == nil {
+        var err error
+        if t, err = m.GetTree(ctx, spaceId, treeId); err != nil { return err }
+        m.forget(spaceId, treeId)
+    }
+    t.Lock()
+    defer t.Unlock()
+    return t.Delete()
+}
+
+// closeSpace closes the cached trees of a space before the space itself closes
+func (m *treeManager) closeSpace(spaceId string) {
+    m.mu.Lock()
+    trees := m.trees[spaceId]
+    delete(m.trees, spaceId)
+    m.mu.Unlock()
+    for id, t := range trees {
+        if err := t.Close(); err != nil { log.Printf("close tree %s: %v", id, err) }
+    }
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+    "context"
+    "log"
+    "sync"
+    "time"
+
+    anyapp "github.com/anyproto/any-sync/app"
+    "github.com/anyproto/any-sync/commonspace/object/tree/synctree"
+    "github.com/anyproto/any-sync/commonspace/object/treemanager"
+    "github.com/anyproto/any-sync/commonspace/object/treesyncer"
+    "github.com/anyproto/any-sync/commonspace/spacestate"
+    "github.com/anyproto/any-sync/net/peer"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+const (
+    // treeSyncWorkers is the number of workers of a space, and so how many
+    // trees it fetches or reconciles at once
+    treeSyncWorkers = 4
+    // treeSyncQueue bounds the trees waiting for a worker
+    treeSyncQueue = 256
+)
+
+// TreeSyncProgress counts the tree sync work head sync handed to a space.
+// Counters are cumulative since the space was opened.
+type TreeSyncProgress struct {
+    Missing    int   `json:"missing"`
+    Fetched    int   `json:"fetched"`
+    Existing   int   `json:"existing"`
+    Reconciled int   `json:"reconciled"`
+    Failed     int   `json:"failed"`
+    InFlight   int   `json:"inFlight"`
+    LastSyncMs int64 `json:"lastSyncMs"`
+}
+
+// treeSyncer is the per-space treesyncer.TreeSyncer. Head sync reports which
+// trees a peer has that we lack (missing) and which differ (existing); missing
+// trees are built through the tree manager, which fetches them from the peer,
+// and existing ones are reconciled with SyncWithPeer. A fixed pool of workers
+// takes them from a bounded queue; when it is full the rest of a round is
+// skipped, and head sync reports those trees again on its next round since
+// they still differ. Only the nodes responsible for the space are synced
+// with: the client has no other peers, and a tree fetched from any other peer
+// would not be one the network keeps.
+type treeSyncer struct {
+    trees   treemanager.TreeManager
+    nodes   nodeconf.Service
+    spaceId string
+    queue   chan treeSyncJob
+    // storage root for crash reports of workers
+    crashRoot string
+
+    mu       sync.Mutex
+    running  bool
+    ctx      context.Context
+    cancel   context.CancelFunc
+    inflight map[string]struct{}
+    progress TreeSyncProgress
+    wg       sync.WaitGroup
+}
+
+type treeSyncJob struct {
+    p       peer.Peer
+    id      string
+    missing bool
+}
+
+// newTreeSyncer returns a syncer whose workers write crash reports under crashRoot
+func newTreeSyncer(crashRoot string) *treeSyncer {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &treeSyncer{queue: make(chan treeSyncJob, treeSyncQueue), crashRoot: crashRoot, ctx: ctx, cancel: cancel, inflight: make(map[string]struct{})}
+}
+
+func (s *treeSyncer) Init(a *anyapp.App) error {
+    s.trees = a.MustComponent(treemanager.CName).(treemanager.TreeManager)
+    s.nodes = a.MustComponent(nodeconf.CName).(nodeconf.Service)
+    s.spaceId = a.MustComponent(spacestate.CName).(*spacestate.SpaceState).SpaceId
+    return nil
+}
+
+func (s *treeSyncer) Name() string { return treesyncer.CName }
+
+// Run starts the workers
+func (s *treeSyncer) Run(ctx context.Context) error {
+    for i := 0; i < treeSyncWorkers; i++ {
+        s.wg.Add(1)
+        go s.worker()
+    }
+    return nil
+}
+
+// Close stops the workers and drops the queued trees
+func (s *treeSyncer) Close(ctx context.Context) error {
+    s.StopSync()
+    s.cancel()
+    s.wg.Wait()
+    for {
+        select {
+        case job := <-s.queue:
+            s.finish(job.id, job.missing, s.ctx.Err())
+        default:
+            return nil
+        }
+    }
+}
+
+func (s *treeSyncer) StartSync() {
+    s.mu.Lock()
+    s.running = true
+    s.mu.Unlock()
+}
+
+func (s *treeSyncer) StopSync() {
+    s.mu.Lock()
+    s.running = false
+    s.mu.Unlock()
+}
+
+// ShouldSync accepts the nodes responsible for the space while syncing runs
+func (s *treeSyncer) ShouldSync(peerId string) bool {
+    s.mu.Lock()
+    running := s.running
+    s.mu.Unlock()
+    return running && s.responsible(peerId)
+}
+
+func (s *treeSyncer) responsible(peerId string) bool {
+    for _, id := range s.nodes.NodeIds(s.spaceId) {
+        if id == peerId { return true }
+    }
+    return false
+}
+
+// SyncAll queues the trees and returns; workers pick them up in the background
+func (s *treeSyncer) SyncAll(ctx context.Context, p peer.Peer, existing, missing []string) error {
+    if !s.ShouldSync(p.Id()) { return nil }
+    for _, id := range missing {
+        if !s.schedule(p, id, true) { return nil }
+    }
+    for _, id := range existing {
+        if !s.schedule(p, id, false) { return nil }
+    }
+    return nil
+}
+
+// schedule queues the tree unless it is queued already; it returns false
+// once the queue is full or the syncer closed
+func (s *treeSyncer) schedule(p peer.Peer, id string, missing bool) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.ctx.Err() != nil { return false }
+    if _, ok := s.inflight[id]; ok { return true }
+    select {
+    case s.queue <- treeSyncJob{p: p, id: id, missing: missing}:
+    default:
+        return false
+    }
+    s.inflight[id] = struct{}{}
+    s.progress.InFlight++
+    if missing { s.progress.Missing++ } else { s.progress.Existing++ }
+    return true
+}
+
+// worker syncs queued trees until the syncer closes
+func (s *treeSyncer) worker() {
+    defer s.wg.Done()
+    for {
+        select {
+        case job := <-s.queue:
+            s.finish(job.id, job.missing, s.work(job.p, job.id, job.missing))
+        case <-s.ctx.Done():
+            return
+        }
+    }
+}
+
+// work fetches or reconciles one tree; a panic fails just this tree
+func (s *treeSyncer) work(p peer.Peer, id string, missing bool) (err error) {
+    defer func() {
+        if r := recover(); r != nil { err = reportPanic(s.crashRoot, "tree sync "+id, r) }
+    }()
+    if missing { return s.fetch(p, id) }
+    return s.reconcile(p, id)
+}
+
+func (s *treeSyncer) finish(id string, missing bool, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.inflight, id)
+    s.progress.InFlight--
+    switch {
+    case err != nil:
+        s.progress.Failed++
+        if s.ctx.Err() == nil { log.Printf("tree sync %s/%s: %v", s.spaceId, id, err) }
+    case missing:
+        s.progress.Fetched++
+    default:
+        s.progress.Reconciled++
+    }
+    s.progress.LastSyncMs = time.Now().UnixMilli()
+}
+
+// fetch builds a tree we do not have yet; the tree manager pulls it from p
+func (s *treeSyncer) fetch(p peer.Peer, id string) error {
+    _, err := s.trees.GetTree(peer.CtxWithPeerId(s.ctx, p.Id()), s.spaceId, id)
+    return err
+}
+
+// reconcile exchanges heads of a tree both sides have
+func (s *treeSyncer) reconcile(p peer.Peer, id string) error {
+    ctx := peer.CtxWithPeerId(s.ctx, p.Id())
+    t, err := s.trees.GetTree(ctx, s.spaceId, id)
+    if err != nil { return err }
+    st, ok := t.(synctree.SyncTree)
+    if !ok { return nil }
+    return st.SyncWithPeer(ctx, p)
+}
+
+func (s *treeSyncer) snapshot() TreeSyncProgress {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.progress
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/anyproto/any-sync/commonspace/object/tree/objecttree"
+    "github.com/anyproto/any-sync/commonspace/object/treemanager"
+    "github.com/anyproto/any-sync/net/peer"
+    "github.com/anyproto/any-sync/nodeconf"
+)
+
+// blockingTrees is a tree manager whose GetTree waits for release and
+// records how many calls ran at once
+type blockingTrees struct {
+    treemanager.TreeManager
+    release chan struct{}
+
+    mu      sync.Mutex
+    running int
+    maxRun  int
+    calls   int
+}
+
+func (b *blockingTrees) GetTree(ctx context.Context, spaceId, treeId string) (objecttree.ObjectTree, error) {
+    b.mu.Lock()
+    b.running++
+    b.calls++
+    if b.running > b.maxRun { b.maxRun = b.running }
+    b.mu.Unlock()
+    defer func() { b.mu.Lock(); b.running--; b.mu.Unlock() }()
+    select {
+    case <-b.release:
+        return nil, nil
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+func (b *blockingTrees) stats() (running, maxRun, calls int) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.running, b.maxRun, b.calls
+}
+
+type testPeer struct {
+    peer.Peer
+    id string
+}
+
+func (p testPeer) Id() string { return p.id }
+
+type testNodes struct {
+    nodeconf.Service
+    ids []string
+}
+
+func (n testNodes) NodeIds(spaceId string) []string { return n.ids }
+
+func newTestSyncer(t *testing.T, trees *blockingTrees) *treeSyncer {
+    t.Helper()
+    s := newTreeSyncer(t.TempDir())
+    s.trees, s.nodes, s.spaceId = trees, testNodes{ids: []string{"node1", "node2"}}, "space"
+    if err := s.Run(context.Background()); err != nil { t.Fatal(err) }
+    s.StartSync()
+    return s
+}
+
+func treeIds(n int) []string {
+    ids := make([]string, n)
+    for i := range ids { ids[i] = fmt.Sprintf("tree%d", i) }
+    return ids
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for !cond() {
+        if time.Now().After(deadline) { t.Fatalf("timed out waiting for %s", what) }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestTreeSyncerWorkerPool(t *testing.T) {
+    trees := &blockingTrees{release: make(chan struct{})}
+    s := newTestSyncer(t, trees)
+    ctx := context.Background()
+    n := treeSyncWorkers + 10
+    if err := s.SyncAll(ctx, testPeer{id: "node1"}, nil, treeIds(n)); err != nil { t.Fatal(err) }
+    waitFor(t, "the workers to start", func() bool { running, _, _ := trees.stats(); return running == treeSyncWorkers })
+    // a tree already queued is not queued twice
+    if err := s.SyncAll(ctx, testPeer{id: "node2"}, treeIds(n), nil); err != nil { t.Fatal(err) }
+    if p := s.snapshot(); p.InFlight != n || p.Missing != n || p.Existing != 0 { t.Fatalf("progress %+v", p) }
+    close(trees.release)
+    waitFor(t, "the queue to drain", func() bool { return s.snapshot().InFlight == 0 })
+    _, maxRun, calls := trees.stats()
+    if maxRun != treeSyncWorkers || calls != n { t.Fatalf("%d calls, %d at once", calls, maxRun) }
+    if p := s.snapshot(); p.Fetched != n || p.Failed != 0 { t.Fatalf("progress %+v", p) }
+    if err := s.Close(ctx); err != nil { t.Fatal(err) }
+}
+
+func TestTreeSyncerQueueFull(t *testing.T) {
+    trees := &blockingTrees{release: make(chan struct{})}
+    s := newTestSyncer(t, trees)
+    ctx := context.Background()
+    n := treeSyncWorkers + treeSyncQueue + 50
+    if err := s.SyncAll(ctx, testPeer{id: "node1"}, nil, treeIds(n)); err != nil { t.Fatal(err) }
+    // the workers hold some, the queue the next treeSyncQueue, the rest waits for the next round
+    if p := s.snapshot(); p.InFlight > treeSyncWorkers+treeSyncQueue || p.InFlight < treeSyncQueue { t.Fatalf("progress %+v", p) }
+    // closing drops the queue and fails the running trees
+    if err := s.Close(ctx); err != nil { t.Fatal(err) }
+    if p := s.snapshot(); p.InFlight != 0 || p.Fetched != 0 || p.Failed != p.Missing { t.Fatalf("progress after close %+v", p) }
+    if err := s.SyncAll(ctx, testPeer{id: "node1"}, nil, treeIds(1)); err != nil || s.snapshot().InFlight != 0 { t.Fatal("queued after close") }
+}
+
+func TestTreeSyncerResponsiblePeers(t *testing.T) {
+    trees := &blockingTrees{release: make(chan struct{})}
+    close(trees.release)
+    s := newTestSyncer(t, trees)
+    defer s.Close(context.Background())
+    if !s.ShouldSync("node2") || s.ShouldSync("stranger") { t.Fatal("peer filter") }
+    if err := s.SyncAll(context.Background(), testPeer{id: "stranger"}, treeIds(3), treeIds(3)); err != nil { t.Fatal(err) }
+    if p := s.snapshot(); p.Missing != 0 || p.Existing != 0 { t.Fatalf("synced with a peer that is not responsible: %+v", p) }
+    s.StopSync()
+    if s.ShouldSync("node1") { t.Fatal("syncing while stopped") }
+}
@@ -0,0 +1,352 @@
+package main
+
+// #include <stdint.h>
+// #include <stdlib.h>
+// typedef void (*callback_t)(char*);
+// // Mirrors Dart_CObject from dart_api.h; only the string variant is posted.
+// // The largest union member, as_external_typed_data (type, length, data,
+// // peer, callback), is 40 bytes on 64-bit targets, so the pad is too; on
+// // 32-bit targets it over-allocates, which is harmless as the VM only reads.
+// typedef struct {
+//     int32_t type;
+//     union { const char* as_string; int64_t pad[5]; } value;
+// } bridge_cobject;
+// _Static_assert(sizeof(void*) != 8 || sizeof(bridge_cobject) == 48, "bridge_cobject must match Dart_CObject");
+// typedef int8_t (*post_cobject_t)(int64_t, bridge_cobject*);
+// static inline int8_t postString(void* fn, int64_t port, char* s) {
+//     bridge_cobject obj;
+//     obj.type = 5; // Dart_CObject_kString
+//     obj.value.as_string = s;
+//     return ((post_cobject_t)fn)(port, &obj);
+// }
+// static inline void dispatchCallback(callback_t cb, char* s) { if (cb) cb(s); }
+import "C"
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "unsafe"
+
+    "anysync_bridge/client"
+)
+
+// subscription is either a Dart native port (preferred) or a raw C callback.
+// C callbacks run on the dispatcher thread, so Dart hosts must register them
+// via NativeCallable.listener and free the string with BridgeFreeString.
+type subscription struct {
+    id      int64
+    spaceId string
+    port    int64
+    cb      C.callback_t
+}
+
+type queuedEvent struct {
+    spaceId string
+    data    string
+}
+
+// eventDispatcher delivers events in the order they were queued. A single
+// goroutine drains the queue, so subscribers of one space never see
+// reordering, and producers (listeners) never block on slow consumers.
+// Spaces without subscribers buffer into pollQueues for BridgePollOperation;
+// when the last subscriber of a space goes away, its undelivered events move
+// back there. A poll queue holds at most pollQueueCap events: past that the
+// oldest are dropped and the next poll, or the next subscriber, first gets an
+// events_dropped event with their count. Closing the space (dropSpace)
+// discards its events. Each client owns one dispatcher.
+type eventDispatcher struct {
+    mu      sync.Mutex
+    cond    *sync.Cond
+    queue   []queuedEvent
+    subs    map[int64]*subscription
+    nextId  int64
+    running bool
+    stopped bool
+
+    pollMu      sync.Mutex
+    pollQueues  map[string][]string
+    pollDropped map[string]int
+}
+
+// pollQueueCap bounds the events buffered per space for BridgePollOperation
+const pollQueueCap = 1024
+
+const eventTypeDropped = "events_dropped"
+
+var errDartApiMissing = errors.New("BridgeInitDartApi must be called before registering ports")
+
+// Dart_PostCObject is process-wide, shared by every client
+var (
+    postCObject unsafe.Pointer
+    postMu      sync.RWMutex
+)
+
+func newEventDispatcher() *eventDispatcher {
+    d := &eventDispatcher{subs: make(map[int64]*subscription), pollQueues: make(map[string][]string), pollDropped: make(map[string]int)}
+    d.cond = sync.NewCond(&d.mu)
+    return d
+}
+
+func (d *eventDispatcher) subscribe(s *subscription) int64 {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    d.nextId++
+    s.id = d.nextId
+    if !d.hasSubscribers(s.spaceId) {
+        // move events buffered for polling onto the push path, ahead of anything newer
+        d.pollMu.Lock()
+        if ev, ok := d.takeDropped(s.spaceId); ok { d.queue = append(d.queue, queuedEvent{spaceId: s.spaceId, data: ev}) }
+        for _, data := range d.pollQueues[s.spaceId] {
+            d.queue = append(d.queue, queuedEvent{spaceId: s.spaceId, data: data})
+        }
+        delete(d.pollQueues, s.spaceId)
+        d.pollMu.Unlock()
+        d.cond.Signal()
+    }
+    d.subs[s.id] = s
+    if !d.running && !d.stopped {
+        d.running = true
+        go d.run()
+    }
+    return s.id
+}
+
+func (d *eventDispatcher) unsubscribe(id int64) bool {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    s, ok := d.subs[id]
+    delete(d.subs, id)
+    if ok { d.requeueForPoll(s.spaceId) }
+    return ok
+}
+
+func (d *eventDispatcher) unsubscribeSpace(spaceId string) int {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    n := 0
+    for id, s := range d.subs {
+        if s.spaceId == spaceId { delete(d.subs, id); n++ }
+    }
+    d.requeueForPoll(spaceId)
+    return n
+}
+
+// requeueForPoll moves queued events of a space that has no subscribers left
+// to the front of its poll queue, in order. Callers hold d.mu.
+func (d *eventDispatcher) requeueForPoll(spaceId string) {
+    if d.hasSubscribers(spaceId) { return }
+    var moved []string
+    kept := d.queue[:0]
+    for _, ev := range d.queue {
+        if ev.spaceId == spaceId { moved = append(moved, ev.data) } else { kept = append(kept, ev) }
+    }
+    d.queue = kept
+    if len(moved) == 0 { return }
+    d.pollMu.Lock()
+    d.pollQueues[spaceId] = append(moved, d.pollQueues[spaceId]...)
+    d.trimPoll(spaceId)
+    d.pollMu.Unlock()
+}
+
+// trimPoll drops the oldest events of a poll queue longer than pollQueueCap
+// and counts them. Callers hold d.pollMu.
+func (d *eventDispatcher) trimPoll(spaceId string) {
+    q := d.pollQueues[spaceId]
+    over := len(q) - pollQueueCap
+    if over <= 0 { return }
+    d.pollQueues[spaceId] = q[over:]
+    d.pollDropped[spaceId] += over
+}
+
+// takeDropped returns the events_dropped event owed to the next reader of a
+// space and resets its count. Callers hold d.pollMu.
+func (d *eventDispatcher) takeDropped(spaceId string) (string, bool) {
+    n := d.pollDropped[spaceId]
+    if n == 0 { return "", false }
+    delete(d.pollDropped, spaceId)
+    data, _ := json.Marshal(map[string]any{"type": eventTypeDropped, "spaceId": spaceId, "count": n})
+    return string(data), true
+}
+
+// dropSpace removes subscriptions and buffered poll events of a closed space
+func (d *eventDispatcher) dropSpace(spaceId string) {
+    d.unsubscribeSpace(spaceId)
+    d.pollMu.Lock()
+    delete(d.pollQueues, spaceId)
+    delete(d.pollDropped, spaceId)
+    d.pollMu.Unlock()
+}
+
+func (d *eventDispatcher) hasSubscribers(spaceId string) bool {
+    for _, s := range d.subs {
+        if s.spaceId == spaceId { return true }
+    }
+    return false
+}
+
+// Dispatch implements client.EventSink: it hands an event to the push path;
+// spaces without subscribers keep using the bounded poll queue so
+// BridgePollOperation still works.
+func (d *eventDispatcher) Dispatch(spaceId string, data string) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.stopped { return }
+    if !d.hasSubscribers(spaceId) {
+        d.pollMu.Lock()
+        d.pollQueues[spaceId] = append(d.pollQueues[spaceId], data)
+        d.trimPoll(spaceId)
+        d.pollMu.Unlock()
+        return
+    }
+    d.queue = append(d.queue, queuedEvent{spaceId: spaceId, data: data})
+    d.cond.Signal()
+}
+
+func (d *eventDispatcher) poll(spaceId string) (string, bool) {
+    d.pollMu.Lock()
+    defer d.pollMu.Unlock()
+    if ev, ok := d.takeDropped(spaceId); ok { return ev, true }
+    q := d.pollQueues[spaceId]
+    if len(q) == 0 { return "", false }
+    if len(q) == 1 {
+        delete(d.pollQueues, spaceId)
+    } else {
+        d.pollQueues[spaceId] = q[1:]
+    }
+    return q[0], true
+}
+
+// stop drops all subscriptions and lets the loop goroutine exit
+func (d *eventDispatcher) stop() {
+    d.mu.Lock()
+    d.stopped = true
+    d.subs = make(map[int64]*subscription)
+    d.queue = nil
+    d.cond.Broadcast()
+    d.mu.Unlock()
+}
+
+// run delivers until the dispatcher stops; after a panic in a callback the
+// event is dropped and a new loop picks up the rest of the queue
+func (d *eventDispatcher) run() {
+    defer func() {
+        d.mu.Lock()
+        defer d.mu.Unlock()
+        d.running = false
+        if !d.stopped && len(d.subs) > 0 {
+            d.running = true
+            go d.run()
+        }
+    }()
+    defer recoverGoroutine("event dispatcher")
+    d.loop()
+}
+
+func (d *eventDispatcher) loop() {
+    for {
+        d.mu.Lock()
+        for len(d.queue) == 0 && !d.stopped { d.cond.Wait() }
+        if d.stopped {
+            d.running = false
+            d.mu.Unlock()
+            return
+        }
+        ev := d.queue[0]
+        d.queue = d.queue[1:]
+        var targets []subscription
+        for _, s := range d.subs {
+            if s.spaceId == ev.spaceId { targets = append(targets, *s) }
+        }
+        d.mu.Unlock()
+        for _, s := range targets { deliver(s, ev.data) }
+    }
+}
+
+func deliver(s subscription, data string) {
+    if s.cb != nil {
+        // receiver owns the string
+        C.dispatchCallback(s.cb, C.CString(data))
+        return
+    }
+    postMu.RLock()
+    fn := postCObject
+    postMu.RUnlock()
+    if fn == nil { return }
+    cs := C.CString(data)
+    // Dart_PostCObject copies the string before returning
+    if ok := C.postString(fn, C.int64_t(s.port), cs); ok == 0 {
+        log.Printf("post to port %d failed (space %s)", s.port, s.spaceId)
+    }
+    C.free(unsafe.Pointer(cs))
+}
+
+// BridgeInitDartApi receives NativeApi.postCObject from Dart. It is
+// process-wide and shared by all client handles.
+//
+//export BridgeInitDartApi
+func BridgeInitDartApi(postFn unsafe.Pointer) C.int {
+    defer recoverExport("init dart api", 0)
+    if postFn == nil { return 0 }
+    postMu.Lock()
+    postCObject = postFn
+    postMu.Unlock()
+    return 1
+}
+
+//export BridgeSetOperationPort
+func BridgeSetOperationPort(handle C.longlong, spaceId *C.char, port C.longlong) C.longlong {
+    defer recoverExport("set operation port", handle)
+    c := lookup("set operation port", handle)
+    if c == nil { return 0 }
+    id := C.GoString(spaceId)
+    postMu.RLock()
+    ready := postCObject != nil
+    postMu.RUnlock()
+    if !ready { c.result("set operation port", errDartApiMissing); return 0 }
+    c.result("set operation port", nil)
+    subId := c.events.subscribe(&subscription{spaceId: id, port: int64(port)})
+    log.Printf("Set port %d for space: %s (subscription %d)", int64(port), id, subId)
+    return C.longlong(subId)
+}
+
+//export BridgeSetOperationCallback
+func BridgeSetOperationCallback(handle C.longlong, spaceId *C.char, callback C.callback_t) C.longlong {
+    defer recoverExport("set operation callback", handle)
+    c := lookup("set operation callback", handle)
+    if c == nil { return 0 }
+    if callback == nil { c.result("set operation callback", fmt.Errorf("%w: nil callback", client.ErrInvalidArgument)); return 0 }
+    c.result("set operation callback", nil)
+    id := C.GoString(spaceId)
+    subId := c.events.subscribe(&subscription{spaceId: id, cb: callback})
+    log.Printf("Set callback for space: %s (subscription %d)", id, subId)
+    return C.longlong(subId)
+}
+
+//export BridgeUnregisterOperationListener
+func BridgeUnregisterOperationListener(handle C.longlong, subscriptionId C.longlong) C.int {
+    defer recoverExport("unregister operation listener", handle)
+    c := lookup("unregister operation listener", handle)
+    if c == nil { return 0 }
+    if c.events.unsubscribe(int64(subscriptionId)) { return 1 }
+    return 0
+}
+
+//export BridgeClearOperationListeners
+func BridgeClearOperationListeners(handle C.longlong, spaceId *C.char) C.int {
+    defer recoverExport("clear operation listeners", handle)
+    c := lookup("clear operation listeners", handle)
+    if c == nil { return 0 }
+    return C.int(c.events.unsubscribeSpace(C.GoString(spaceId)))
+}
+
+//export BridgePollOperation
+func BridgePollOperation(handle C.longlong, spaceId *C.char) *C.char {
+    defer recoverExport("poll operation", handle)
+    c := lookup("poll operation", handle)
+    if c == nil { return nil }
+    msg, ok := c.events.poll(C.GoString(spaceId))
+    if !ok { return nil }
+    return C.CString(msg)
+}
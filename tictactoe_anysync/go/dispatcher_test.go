@@ -0,0 +1,89 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "testing"
+)
+
+func pollAll(d *eventDispatcher, spaceId string) []string {
+    var out []string
+    for {
+        ev, ok := d.poll(spaceId)
+        if !ok { return out }
+        out = append(out, ev)
+    }
+}
+
+func TestDispatcherPollOrder(t *testing.T) {
+    d := newEventDispatcher()
+    defer d.stop()
+    for i := 0; i < 3; i++ {
+        d.Dispatch("a", fmt.Sprint(i))
+        d.Dispatch("b", fmt.Sprint(10+i))
+    }
+    if got := fmt.Sprint(pollAll(d, "a")); got != "[0 1 2]" { t.Fatalf("space a polled %s", got) }
+    if got := fmt.Sprint(pollAll(d, "b")); got != "[10 11 12]" { t.Fatalf("space b polled %s", got) }
+    if _, ok := d.poll("a"); ok { t.Fatal("polled a drained queue") }
+}
+
+func TestDispatcherPollQueueCap(t *testing.T) {
+    d := newEventDispatcher()
+    defer d.stop()
+    const extra = 5
+    for i := 0; i < pollQueueCap+extra; i++ { d.Dispatch("a", fmt.Sprint(i)) }
+    got := pollAll(d, "a")
+    if len(got) != pollQueueCap+1 { t.Fatalf("polled %d events, want %d", len(got), pollQueueCap+1) }
+    var dropped struct {
+        Type    string `json:"type"`
+        SpaceId string `json:"spaceId"`
+        Count   int    `json:"count"`
+    }
+    if err := json.Unmarshal([]byte(got[0]), &dropped); err != nil { t.Fatal(err) }
+    if dropped.Type != eventTypeDropped || dropped.SpaceId != "a" || dropped.Count != extra { t.Fatalf("first event %s", got[0]) }
+    // the oldest events went, the newest stay in order
+    if got[1] != fmt.Sprint(extra) || got[len(got)-1] != fmt.Sprint(pollQueueCap+extra-1) { t.Fatalf("kept %s .. %s", got[1], got[len(got)-1]) }
+    // the count is reported once
+    d.Dispatch("a", "next")
+    if got := pollAll(d, "a"); len(got) != 1 || got[0] != "next" { t.Fatalf("after the report %v", got) }
+}
+
+func TestDispatcherSubscribeTakesPollQueue(t *testing.T) {
+    d := newEventDispatcher()
+    defer d.stop()
+    for i := 0; i < pollQueueCap+1; i++ { d.Dispatch("a", fmt.Sprint(i)) }
+    d.Dispatch("b", "b0")
+    // deliver skips ports while the Dart API is not initialized
+    id := d.subscribe(&subscription{spaceId: "a", port: 1})
+    if _, ok := d.poll("a"); ok { t.Fatal("events left for polling after subscribing") }
+    d.mu.Lock()
+    d.pollMu.Lock()
+    dropped := d.pollDropped["a"]
+    d.pollMu.Unlock()
+    d.mu.Unlock()
+    if dropped != 0 { t.Fatalf("dropped count %d kept after subscribing", dropped) }
+    if got := pollAll(d, "b"); len(got) != 1 { t.Fatalf("space b polled %v", got) }
+    if !d.unsubscribe(id) || d.unsubscribe(id) { t.Fatal("unsubscribe not reported once") }
+    d.Dispatch("a", "later")
+    if got := pollAll(d, "a"); len(got) == 0 || got[len(got)-1] != "later" { t.Fatalf("polled %v after unsubscribing", got) }
+}
+
+func TestDispatcherDropSpace(t *testing.T) {
+    d := newEventDispatcher()
+    defer d.stop()
+    for i := 0; i < pollQueueCap+1; i++ { d.Dispatch("a", fmt.Sprint(i)) }
+    d.subscribe(&subscription{spaceId: "b", port: 1})
+    d.dropSpace("a")
+    d.dropSpace("b")
+    if _, ok := d.poll("a"); ok { t.Fatal("events of a closed space left") }
+    if n := d.unsubscribeSpace("b"); n != 0 { t.Fatalf("%d subscriptions of a closed space left", n) }
+    d.Dispatch("a", "reopened")
+    if got := pollAll(d, "a"); len(got) != 1 || got[0] != "reopened" { t.Fatalf("reopened space polled %v", got) }
+}
+
+func TestDispatcherStop(t *testing.T) {
+    d := newEventDispatcher()
+    d.stop()
+    d.Dispatch("a", "x")
+    if _, ok := d.poll("a"); ok { t.Fatal("queued an event after stop") }
+}
@@ -0,0 +1,99 @@
+package main
+
+// #include <stdlib.h>
+import "C"
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+
+    "anysync_bridge/client"
+)
+
+// Exports keep their 0 / empty-string failure returns; the reason is kept
+// per handle and read with BridgeLastError. Every export resets it, so it
+// describes the most recent call on that handle. Failures without a usable
+// handle (BridgeNewClient, unknown handles) go to a process-wide slot that
+// BridgeLastError(0) returns.
+
+var errUnknownHandle = errors.New("unknown client handle")
+
+type errorReport struct {
+    Code    client.Code `json:"code"`
+    Op      string      `json:"op"`
+    Message string      `json:"message"`
+    Causes  []string    `json:"causes"`
+    // failing CreateSpace stage (create, open, sign, push)
+    Stage string `json:"stage,omitempty"`
+    // set for recovered panics only
+    Stack       string `json:"stack,omitempty"`
+    CrashReport string `json:"crashReport,omitempty"`
+}
+
+type lastError struct {
+    mu  sync.Mutex
+    rep *errorReport
+}
+
+var globalLastError lastError
+
+func (l *lastError) set(op string, err error) {
+    var rep *errorReport
+    if err != nil {
+        code := client.ErrorCode(err)
+        if errors.Is(err, errUnknownHandle) { code = client.CodeInvalidHandle }
+        rep = &errorReport{Code: code, Op: op, Message: err.Error(), Causes: client.ErrorCauses(err)}
+        var stageErr *client.StageError
+        if errors.As(err, &stageErr) { rep.Stage = string(stageErr.Stage) }
+        log.Printf("%s: [%s] %v", op, code, err)
+    }
+    l.mu.Lock()
+    l.rep = rep
+    l.mu.Unlock()
+}
+
+func (l *lastError) setCrash(op string, perr *client.PanicError, reportPath string) {
+    log.Printf("%s: recovered %v\n%s", op, perr.Value, perr.Stack)
+    rep := &errorReport{
+        Code: client.CodePanic, Op: op, Message: perr.Error(), Causes: client.ErrorCauses(perr),
+        Stack: string(perr.Stack), CrashReport: reportPath,
+    }
+    l.mu.Lock()
+    l.rep = rep
+    l.mu.Unlock()
+}
+
+func (l *lastError) json() string {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.rep == nil { return "" }
+    b, _ := json.Marshal(l.rep)
+    return string(b)
+}
+
+// result records the outcome of op on the handle and reports success
+func (c *bridgeClient) result(op string, err error) bool {
+    c.lastErr.set(op, err)
+    return err == nil
+}
+
+// lookup resolves a handle for op, recording invalid_handle when it is unknown
+func lookup(op string, handle C.longlong) *bridgeClient {
+    c := clientFor(handle)
+    if c == nil { globalLastError.set(op, fmt.Errorf("%w: %d", errUnknownHandle, int64(handle))) }
+    return c
+}
+
+// BridgeLastError returns {"code","op","message","causes"} for the last failed
+// call on handle, or an empty string when that call succeeded. Recovered
+// panics add "stack" and "crashReport". Handle 0 (or an unknown handle)
+// reads the process-wide slot.
+//
+//export BridgeLastError
+func BridgeLastError(handle C.longlong) *C.char {
+    defer recoverExport("last error", handle)
+    if c := clientFor(handle); c != nil { return C.CString(c.lastErr.json()) }
+    return C.CString(globalLastError.json())
+}
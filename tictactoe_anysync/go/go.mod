@@ -5,7 +5,8 @@ go 1.23.10
 require (
 	github.com/anyproto/any-store v0.3.3
 	github.com/anyproto/any-sync v0.9.5
-	github.com/anyproto/any-sync-node v0.0.0
+	golang.org/x/crypto v0.41.0
+	gopkg.in/yaml.v3 v3.0.1
 	storj.io/drpc v0.0.34
 )
 
@@ -75,7 +76,6 @@ require (
 	go.uber.org/mock v0.5.2 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/exp v0.0.0-20250718183923-645b1fa84792 // indirect
 	golang.org/x/image v0.21.0 // indirect
 	golang.org/x/mod v0.26.0 // indirect
@@ -86,7 +86,6 @@ require (
 	golang.org/x/time v0.12.0 // indirect
 	golang.org/x/tools v0.35.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	lukechampine.com/blake3 v1.4.1 // indirect
 	modernc.org/libc v1.66.3 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
@@ -94,7 +93,5 @@ require (
 	modernc.org/sqlite v1.38.0 // indirect
 )
 
-replace github.com/anyproto/any-sync-node => ../research/any-sync-node
-
 // replace directives for local development can be added as needed, e.g.:
 // replace github.com/anyproto/any-sync => ../../any-sync
@@ -0,0 +1,207 @@
+package main
+
+// #include <stdlib.h>
+import "C"
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+
+    "anysync_bridge/client"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+// clientConfig is the JSON accepted by BridgeNewClient
+type clientConfig struct {
+    // StorageRoot holds spaces/ and account.json; defaults to ~/.tictactoe_anysync
+    StorageRoot string `json:"storageRoot"`
+    // Demo runs without any-sync (in-process echo), like ANYSYNC_DEMO_MODE=1
+    Demo bool `json:"demo"`
+    // Storage is {"backend": "disk"|"memory", "root": "..."}; disk under storageRoot/spaces by default
+    Storage client.StorageOptions `json:"storage"`
+    // LayoutDryRun leaves an old storage layout as is; BridgeCheckLayout reports it
+    LayoutDryRun bool `json:"layoutDryRun"`
+}
+
+// Handle table: every export except BridgeNewClient, BridgeInitDartApi and
+// BridgeFreeString takes the handle returned by BridgeNewClient, so several
+// independent clients (own account, storage root and app) can share a process.
+var (
+    clientsMu  sync.RWMutex
+    clients    = make(map[int64]*bridgeClient)
+    nextHandle int64
+)
+
+func clientFor(handle C.longlong) *bridgeClient {
+    clientsMu.RLock()
+    defer clientsMu.RUnlock()
+    return clients[int64(handle)]
+}
+
+//export BridgeNewClient
+func BridgeNewClient(configJson *C.char) C.longlong {
+    defer recoverExport("new client", 0)
+    initLogger()
+    var cfg clientConfig
+    if raw := C.GoString(configJson); raw != "" {
+        if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+            globalLastError.set("new client", fmt.Errorf("client config: %w: %w", client.ErrInvalidArgument, err))
+            return 0
+        }
+    }
+    events := newEventDispatcher()
+    cl, err := client.New(client.Options{StorageRoot: cfg.StorageRoot, Demo: cfg.Demo, Events: events, Storage: cfg.Storage, LayoutDryRun: cfg.LayoutDryRun})
+    globalLastError.set("new client", err)
+    if err != nil { return 0 }
+    clientsMu.Lock()
+    defer clientsMu.Unlock()
+    nextHandle++
+    c := &bridgeClient{handle: nextHandle, Client: cl, events: events}
+    clients[c.handle] = c
+    log.Printf("New client handle %d (storage root %s)", c.handle, cl.StorageRoot())
+    return C.longlong(c.handle)
+}
+
+// BridgeFreeClient shuts the client down and invalidates its handle
+//
+//export BridgeFreeClient
+func BridgeFreeClient(handle C.longlong) C.int {
+    defer recoverExport("free client", handle)
+    clientsMu.Lock()
+    c := clients[int64(handle)]
+    delete(clients, int64(handle))
+    clientsMu.Unlock()
+    if c == nil {
+        globalLastError.set("free client", fmt.Errorf("%w: %d", errUnknownHandle, int64(handle)))
+        return 0
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    err := c.Shutdown(ctx)
+    c.events.stop()
+    // the handle is gone, so report through the process-wide slot
+    globalLastError.set("free client", err)
+    if err != nil { return 0 }
+    return 1
+}
+
+// dropListeners removes Dart subscriptions and poll queues of the given spaces
+func (c *bridgeClient) dropListeners(spaces []client.SpaceInfo) {
+    for _, in := range spaces { c.events.dropSpace(in.SpaceId) }
+}
+
+//export BridgeInitializeClient
+func BridgeInitializeClient(handle C.longlong, nodeHost *C.char, nodePort C.int, networkId *C.char) C.int {
+    defer recoverExport("initialize", handle)
+    c := lookup("initialize", handle)
+    if c == nil { return 0 }
+    // re-initializing replaces the previous app; its spaces' listeners go with it
+    open := c.ListSpaces()
+    err := c.Start(C.GoString(nodeHost), int(nodePort), C.GoString(networkId))
+    c.dropListeners(open)
+    if !c.result("initialize", err) { return 0 }
+    log.Printf("Client %d initialized", c.handle)
+    return 1
+}
+
+// BridgeInitializeFromClientConfig is BridgeInitializeClient with the network
+// id and node list read from an any-sync-dockercompose client.yml
+//
+//export BridgeInitializeFromClientConfig
+func BridgeInitializeFromClientConfig(handle C.longlong, path *C.char) C.int {
+    defer recoverExport("initialize from config", handle)
+    c := lookup("initialize from config", handle)
+    if c == nil { return 0 }
+    conf, err := client.LoadClientConfig(C.GoString(path))
+    if !c.result("initialize from config", err) { return 0 }
+    open := c.ListSpaces()
+    err = c.StartWithNodeConf(conf)
+    c.dropListeners(open)
+    if !c.result("initialize from config", err) { return 0 }
+    log.Printf("Client %d initialized from %s (network %s, %d nodes)", c.handle, C.GoString(path), conf.NetworkId, len(conf.Nodes))
+    return 1
+}
+
+//export BridgeShutdown
+func BridgeShutdown(handle C.longlong) C.int {
+    defer recoverExport("shutdown", handle)
+    c := lookup("shutdown", handle)
+    if c == nil { return 0 }
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    open := c.ListSpaces()
+    err := c.Shutdown(ctx)
+    c.dropListeners(open)
+    if !c.result("shutdown", err) { return 0 }
+    log.Printf("Client %d shut down", c.handle)
+    return 1
+}
+
+// BridgeCheckLayout verifies the storage layout and returns the migrations it
+// needs as {"root","version","target","dryRun","steps":[{"from","to","name",
+// "changes"}],"problems"} without changing anything
+//
+//export BridgeCheckLayout
+func BridgeCheckLayout(handle C.longlong) *C.char {
+    defer recoverExport("check layout", handle)
+    c := lookup("check layout", handle)
+    if c == nil { return C.CString("") }
+    rep, err := c.CheckLayout()
+    if !c.result("check layout", err) { return C.CString("") }
+    b, err := json.Marshal(rep)
+    if !c.result("check layout", err) { return C.CString("") }
+    return C.CString(string(b))
+}
+
+// BridgeMigrateLayout applies the pending layout migrations of a client
+// created with layoutDryRun, before it is initialized; returns the report
+//
+//export BridgeMigrateLayout
+func BridgeMigrateLayout(handle C.longlong) *C.char {
+    defer recoverExport("migrate layout", handle)
+    c := lookup("migrate layout", handle)
+    if c == nil { return C.CString("") }
+    rep, err := c.MigrateLayout()
+    if !c.result("migrate layout", err) { return C.CString("") }
+    b, err := json.Marshal(rep)
+    if !c.result("migrate layout", err) { return C.CString("") }
+    return C.CString(string(b))
+}
+
+// BridgeWipeLocalData is the secure logout: it shuts the client down, locks
+// the account and deletes its local spaces, keystore and node configs. The
+// handle stays valid for a new account.
+//
+//export BridgeWipeLocalData
+func BridgeWipeLocalData(handle C.longlong) C.int {
+    defer recoverExport("wipe local data", handle)
+    c := lookup("wipe local data", handle)
+    if c == nil { return 0 }
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    open := c.ListSpaces()
+    err := c.WipeLocalData(ctx)
+    c.dropListeners(open)
+    if !c.result("wipe local data", err) { return 0 }
+    log.Printf("Client %d wiped its local data", c.handle)
+    return 1
+}
+
+// BridgeReconfigure tears the running app down and starts a new one with
+// the given node settings and the same account. Spaces that were open are
+// reopened and their listeners resumed; Dart subscriptions are kept.
+//
+//export BridgeReconfigure
+func BridgeReconfigure(handle C.longlong, nodeHost *C.char, nodePort C.int, networkId *C.char) C.int {
+    defer recoverExport("reconfigure", handle)
+    c := lookup("reconfigure", handle)
+    if c == nil { return 0 }
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    if !c.result("reconfigure", c.Reconfigure(ctx, C.GoString(nodeHost), int(nodePort), C.GoString(networkId))) { return 0 }
+    return 1
+}
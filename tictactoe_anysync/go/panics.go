@@ -0,0 +1,41 @@
+package main
+
+import "C"
+import (
+    "log"
+    "runtime/debug"
+
+    "anysync_bridge/client"
+)
+
+// A panic must never unwind across the cgo boundary: that aborts the host
+// process (the Flutter app). Every export defers recoverExport, which turns
+// the panic into a "panic" error on the handle's BridgeLastError slot and
+// writes a crash report; the export then returns its zero value (0 / NULL).
+// Goroutines are covered by recoverGoroutine here and by the client's own
+// recovery (client/crash.go).
+
+func recoverExport(op string, handle C.longlong) {
+    r := recover()
+    if r == nil { return }
+    perr := &client.PanicError{Value: r, Stack: debug.Stack()}
+    c := clientFor(handle)
+    root := client.DefaultStorageRoot()
+    if c != nil { root = c.StorageRoot() }
+    path, err := client.WriteCrashReport(root, op, int64(handle), perr)
+    if err != nil { log.Printf("crash report: %v", err) }
+    slot := &globalLastError
+    if c != nil { slot = &c.lastErr }
+    slot.setCrash(op, perr, path)
+}
+
+// recoverGoroutine is deferred by goroutines of the bridge itself; reports go
+// under the default storage root since they are not tied to one client
+func recoverGoroutine(name string) {
+    r := recover()
+    if r == nil { return }
+    perr := &client.PanicError{Value: r, Stack: debug.Stack()}
+    path, err := client.WriteCrashReport(client.DefaultStorageRoot(), name, 0, perr)
+    if err != nil { log.Printf("%s: %v (crash report: %v)", name, perr, err); return }
+    log.Printf("%s: %v (crash report %s)", name, perr, path)
+}
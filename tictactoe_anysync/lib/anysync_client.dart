@@ -1,33 +1,84 @@
 import 'dart:convert';
-import 'dart:async';
 import 'dart:ffi';
+import 'dart:isolate';
 import 'package:ffi/ffi.dart';
 import 'ffi/anysync_bindings.dart';
 
 class AnySyncClient {
   static AnySyncClient? _instance;
-  static void Function(TicTacToeEvent)? _eventHandler;
+  void Function(TicTacToeEvent)? _eventHandler;
 
+  /// Bridge client handle; each AnySyncClient owns an independent bridge
+  /// instance (account, storage root, app).
+  final int _handle;
   bool _initialized = false;
   String? _currentSpaceId;
-  Timer? _pollTimer;
+  ReceivePort? _eventPort;
+  int _subscriptionId = 0;
+  static bool _dartApiReady = false;
 
   static AnySyncClient get instance {
     _instance ??= AnySyncClient._();
     return _instance!;
   }
 
-  AnySyncClient._();
+  AnySyncClient._() : _handle = _newClient(const {});
 
+  /// Creates an additional, independent client. [storageRoot] keeps its
+  /// account and spaces apart from other clients in the same process.
+  /// [storageBackend] is 'disk' (default) or 'memory' (spaces are dropped on
+  /// shutdown); [spacesRoot] moves the disk spaces out of `<storageRoot>/spaces`.
+  /// [layoutDryRun] leaves an old storage layout untouched; see [checkLayout].
+  /// Such a client cannot be initialized (lastError code `layout_pending`)
+  /// until [migrateLayout] has applied the pending steps.
+  AnySyncClient({
+    String? storageRoot,
+    bool demo = false,
+    String? storageBackend,
+    String? spacesRoot,
+    bool layoutDryRun = false,
+  }) : _handle = _newClient({
+          if (storageRoot != null) 'storageRoot': storageRoot,
+          if (demo) 'demo': true,
+          if (layoutDryRun) 'layoutDryRun': true,
+          if (storageBackend != null || spacesRoot != null)
+            'storage': {
+              if (storageBackend != null) 'backend': storageBackend,
+              if (spacesRoot != null) 'root': spacesRoot,
+            },
+        });
+
+  static int _newClient(Map<String, dynamic> config) {
+    final configPtr = jsonEncode(config).toNativeUtf8();
+    try {
+      final handle = newClientNative(configPtr);
+      if (handle == 0) throw StateError('Failed to create bridge client');
+      return handle;
+    } finally {
+      malloc.free(configPtr);
+    }
+  }
+
+  /// Unlocks the account with [passphrase] (creating it on first launch) and
+  /// starts the client. Returns false, with [lastError] set, when the account
+  /// cannot be unlocked or the client does not start. A newly created
+  /// account's mnemonic is passed to [onAccountCreated]; it is the only way
+  /// to restore the identity and is not shown again.
   Future<bool> initialize({
     String nodeHost = 'localhost',
     int nodePort = 8080,
     String networkId = 'tictactoe-network',
+    required String passphrase,
+    void Function(String mnemonic)? onAccountCreated,
   }) async {
+    if (!await ensureAccount(passphrase, onAccountCreated: onAccountCreated)) return false;
+    // Re-initializing tears down this client's previous app (spaces, listeners).
+    stopListening();
+    _currentSpaceId = null;
     final hostPtr = nodeHost.toNativeUtf8();
     final networkIdPtr = networkId.toNativeUtf8();
     try {
-      final result = initializeClientNative(hostPtr, nodePort, networkIdPtr);
+      final result = initializeClientNative(_handle, hostPtr, nodePort, networkIdPtr);
       _initialized = result == 1;
       return _initialized;
     } finally {
@@ -36,24 +87,292 @@ class AnySyncClient {
     }
   }
 
+  /// Like [initialize], but takes the network id and every node (peer ids and
+  /// addresses) from the client.yml generated by any-sync-dockercompose.
+  Future<bool> initializeFromClientConfig(
+    String path, {
+    required String passphrase,
+    void Function(String mnemonic)? onAccountCreated,
+  }) async {
+    if (!await ensureAccount(passphrase, onAccountCreated: onAccountCreated)) return false;
+    stopListening();
+    _currentSpaceId = null;
+    final pathPtr = path.toNativeUtf8();
+    try {
+      _initialized = initializeFromClientConfigNative(_handle, pathPtr) == 1;
+      return _initialized;
+    } finally {
+      malloc.free(pathPtr);
+    }
+  }
+
+  /// Switches node settings in place; open spaces and listeners are resumed.
+  Future<bool> reconfigure({
+    required String nodeHost,
+    required int nodePort,
+    required String networkId,
+  }) async {
+    final hostPtr = nodeHost.toNativeUtf8();
+    final networkIdPtr = networkId.toNativeUtf8();
+    try {
+      _initialized = reconfigureNative(_handle, hostPtr, nodePort, networkIdPtr) == 1;
+      return _initialized;
+    } finally {
+      malloc.free(hostPtr);
+      malloc.free(networkIdPtr);
+    }
+  }
+
+  Future<void> shutdown() async {
+    stopListening();
+    _currentSpaceId = null;
+    _initialized = false;
+    shutdownNative(_handle);
+  }
+
+  /// Verifies the storage layout and reports the migrations it still needs
+  /// ({version, target, steps: [{from, to, name, changes}], problems}).
+  Map<String, dynamic>? checkLayout() {
+    final raw = _takeString(checkLayoutNative(_handle));
+    return raw == null ? null : json.decode(raw) as Map<String, dynamic>;
+  }
+
+  /// Applies pending layout migrations of a `layoutDryRun` client; it must
+  /// succeed before the client can be initialized.
+  Map<String, dynamic>? migrateLayout() {
+    final raw = _takeString(migrateLayoutNative(_handle));
+    return raw == null ? null : json.decode(raw) as Map<String, dynamic>;
+  }
+
+  /// Secure logout: shuts down, locks the account and deletes the local data
+  /// the bridge owns (space directories, keystore, node configs, crash
+  /// reports, work copies); other files in the roots are kept. Spaces stay on
+  /// the network.
+  Future<bool> wipeLocalData() async {
+    stopListening();
+    _currentSpaceId = null;
+    _initialized = false;
+    return wipeLocalDataNative(_handle) == 1;
+  }
+
+  /// Shuts the client down and releases its handle; the object is unusable
+  /// afterwards.
+  void dispose() {
+    stopListening();
+    _currentSpaceId = null;
+    _initialized = false;
+    freeClientNative(_handle);
+    if (identical(_instance, this)) _instance = null;
+  }
+
+  /// Unlocks the on-disk keystore, creating a new account on first launch so
+  /// the same identity is used across restarts. A wrong passphrase fails
+  /// (bad_passphrase) instead of creating another account, as does a damaged
+  /// keystore (keystore_corrupt). The passphrase must not be empty.
+  Future<bool> ensureAccount(String passphrase, {void Function(String mnemonic)? onAccountCreated}) async {
+    if (passphrase.isEmpty) throw ArgumentError.value(passphrase, 'passphrase', 'must not be empty');
+    final ptr = passphrase.toNativeUtf8();
+    final unlocked = unlockAccountNative(_handle, ptr);
+    malloc.free(ptr);
+    if (unlocked == 1) return true;
+    // -1: no keystore yet; anything else is a wrong passphrase or bad file
+    if (unlocked != -1) return false;
+    final mnemonic = await createAccount(passphrase);
+    if (mnemonic == null) return false;
+    onAccountCreated?.call(mnemonic);
+    return true;
+  }
+
+  Future<bool> unlockAccount(String passphrase) async {
+    final ptr = passphrase.toNativeUtf8();
+    try {
+      return unlockAccountNative(_handle, ptr) == 1;
+    } finally {
+      malloc.free(ptr);
+    }
+  }
+
+  /// Returns the new account's mnemonic, or null if a keystore already exists.
+  Future<String?> createAccount(String passphrase) async {
+    final ptr = passphrase.toNativeUtf8();
+    final resultPtr = createAccountNative(_handle, ptr);
+    malloc.free(ptr);
+    return _takeString(resultPtr);
+  }
+
+  /// Stores [mnemonic] under [passphrase]. An existing keystore is replaced
+  /// only if [oldPassphrase] opens it or [overwrite] is set.
+  Future<bool> importMnemonic(
+    String mnemonic,
+    String passphrase, {
+    String oldPassphrase = '',
+    bool overwrite = false,
+  }) async {
+    final mnemonicPtr = mnemonic.toNativeUtf8();
+    final passPtr = passphrase.toNativeUtf8();
+    final oldPtr = oldPassphrase.toNativeUtf8();
+    try {
+      return importMnemonicNative(_handle, mnemonicPtr, passPtr, oldPtr, overwrite ? 1 : 0) == 1;
+    } finally {
+      malloc.free(mnemonicPtr);
+      malloc.free(passPtr);
+      malloc.free(oldPtr);
+    }
+  }
+
+  Future<String?> exportMnemonic(String passphrase) async {
+    final ptr = passphrase.toNativeUtf8();
+    final resultPtr = exportMnemonicNative(_handle, ptr);
+    malloc.free(ptr);
+    return _takeString(resultPtr);
+  }
+
+  /// Why the most recent bridge call on this client failed, or null if it
+  /// succeeded. Codes are stable (e.g. space_not_found, node_unreachable,
+  /// network_config_not_found, invalid_move, bad_passphrase).
+  AnySyncError? lastError() => AnySyncError._parse(_takeString(lastErrorNative(_handle)));
+
+  /// Process-wide error slot, used when no client handle could be created.
+  static AnySyncError? lastGlobalError() => AnySyncError._parse(_takeString(lastErrorNative(0)));
+
+  static String? _takeString(Pointer<Utf8> ptr) {
+    if (ptr == nullptr) return null;
+    try {
+      final value = ptr.toDartString();
+      return value.isEmpty ? null : value;
+    } finally {
+      freeStringNative(ptr);
+    }
+  }
+
+  /// Stages of the last successful create (create, open, sign, push), e.g.
+  /// `{"stage": "push", "ok": false, "error": "..."}`. On failure the failing
+  /// stage is in [lastError]'s `stage`.
+  List<Map<String, dynamic>> lastCreateStages = const [];
+
   Future<String?> createTicTacToeSpace() async {
     if (!_initialized) return null;
-    final resultPtr = createSpaceNative();
+    final resultPtr = createSpaceWithReportNative(_handle);
     if (resultPtr == nullptr) return null;
-    final spaceId = resultPtr.toDartString();
+    final raw = resultPtr.toDartString();
     freeStringNative(resultPtr);
-    if (spaceId.trim().isEmpty) {
+    if (raw.trim().isEmpty) {
       return null;
     }
+    final report = json.decode(raw) as Map<String, dynamic>;
+    lastCreateStages = (report['stages'] as List?)?.whereType<Map<String, dynamic>>().toList() ?? const [];
+    final spaceId = report['spaceId'] as String;
     _currentSpaceId = spaceId;
     return spaceId;
   }
 
+  /// Invite payload for the current space; share it with the opponent, who
+  /// joins with [joinWithInvite] under their own identity.
+  Future<String?> createInvite() async {
+    if (!_initialized || _currentSpaceId == null) return null;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    try {
+      return _takeString(createInviteNative(_handle, spaceIdPtr));
+    } finally {
+      malloc.free(spaceIdPtr);
+    }
+  }
+
+  Future<bool> joinWithInvite(String payload) async {
+    if (!_initialized) return false;
+    final payloadPtr = payload.toNativeUtf8();
+    try {
+      if (joinWithInviteNative(_handle, payloadPtr) != 1) return false;
+      _currentSpaceId = (json.decode(payload) as Map<String, dynamic>)['spaceId'] as String;
+      return true;
+    } finally {
+      malloc.free(payloadPtr);
+    }
+  }
+
+  /// Files a join request for [spaceId]; the owner sees a `join_request`
+  /// event on the operation stream. Join the space once it is approved.
+  Future<bool> requestJoin(String spaceId) async {
+    if (!_initialized) return false;
+    final spaceIdPtr = spaceId.toNativeUtf8();
+    try {
+      return requestJoinNative(_handle, spaceIdPtr) == 1;
+    } finally {
+      malloc.free(spaceIdPtr);
+    }
+  }
+
+  /// Accepts a join request; [permission] is `reader`, `writer` or `admin`.
+  Future<bool> approveJoin(String identity, {String permission = 'writer'}) async {
+    if (!_initialized || _currentSpaceId == null) return false;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final identityPtr = identity.toNativeUtf8();
+    final permissionPtr = permission.toNativeUtf8();
+    try {
+      return approveJoinNative(_handle, spaceIdPtr, identityPtr, permissionPtr) == 1;
+    } finally {
+      malloc.free(spaceIdPtr);
+      malloc.free(identityPtr);
+      malloc.free(permissionPtr);
+    }
+  }
+
+  Future<bool> declineJoin(String identity) async {
+    if (!_initialized || _currentSpaceId == null) return false;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final identityPtr = identity.toNativeUtf8();
+    try {
+      return declineJoinNative(_handle, spaceIdPtr, identityPtr) == 1;
+    } finally {
+      malloc.free(spaceIdPtr);
+      malloc.free(identityPtr);
+    }
+  }
+
+  /// Members of the current space from its ACL: identity, permissions
+  /// (owner, admin, writer, reader), joinedMs, self. Changes arrive as
+  /// `acl_change` events on the operation stream.
+  Future<List<Map<String, dynamic>>> listMembers() async {
+    if (!_initialized || _currentSpaceId == null) return const [];
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final raw = _takeString(listMembersNative(_handle, spaceIdPtr));
+    malloc.free(spaceIdPtr);
+    if (raw == null) return const [];
+    return (json.decode(raw) as List).whereType<Map<String, dynamic>>().toList();
+  }
+
+  Future<bool> setPermissions(String identity, String permission) async {
+    if (!_initialized || _currentSpaceId == null) return false;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final identityPtr = identity.toNativeUtf8();
+    final permissionPtr = permission.toNativeUtf8();
+    try {
+      return setPermissionsNative(_handle, spaceIdPtr, identityPtr, permissionPtr) == 1;
+    } finally {
+      malloc.free(spaceIdPtr);
+      malloc.free(identityPtr);
+      malloc.free(permissionPtr);
+    }
+  }
+
+  /// Removes a member; the read key is rotated so they cannot read new moves.
+  Future<bool> removeMember(String identity) async {
+    if (!_initialized || _currentSpaceId == null) return false;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final identityPtr = identity.toNativeUtf8();
+    try {
+      return removeMemberNative(_handle, spaceIdPtr, identityPtr) == 1;
+    } finally {
+      malloc.free(spaceIdPtr);
+      malloc.free(identityPtr);
+    }
+  }
+
   Future<bool> joinTicTacToeSpace(String spaceId) async {
     if (!_initialized) return false;
     final spaceIdPtr = spaceId.toNativeUtf8();
     try {
-      final result = joinSpaceNative(spaceIdPtr);
+      final result = joinSpaceNative(_handle, spaceIdPtr);
       if (result == 1) {
         _currentSpaceId = spaceId;
         return true;
@@ -70,7 +389,7 @@ class AnySyncClient {
     final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
     final operationPtr = operationJson.toNativeUtf8();
     try {
-      final result = sendOperationNative(spaceIdPtr, operationPtr);
+      final result = sendOperationNative(_handle, spaceIdPtr, operationPtr);
       return result == 1;
     } finally {
       malloc.free(spaceIdPtr);
@@ -89,7 +408,7 @@ class AnySyncClient {
     final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
     final operationPtr = payload.toNativeUtf8();
     try {
-      final result = sendOperationNative(spaceIdPtr, operationPtr);
+      final result = sendOperationNative(_handle, spaceIdPtr, operationPtr);
       return result == 1;
     } finally {
       malloc.free(spaceIdPtr);
@@ -141,7 +460,7 @@ class AnySyncClient {
     final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
     final operationPtr = jsonEncode(payload).toNativeUtf8();
     try {
-      final result = sendOperationNative(spaceIdPtr, operationPtr);
+      final result = sendOperationNative(_handle, spaceIdPtr, operationPtr);
       return result == 1;
     } finally {
       malloc.free(spaceIdPtr);
@@ -152,27 +471,176 @@ class AnySyncClient {
   void startListening(void Function(TicTacToeEvent) onEvent) {
     if (!_initialized || _currentSpaceId == null) return;
     _eventHandler = onEvent;
-    _pollTimer?.cancel();
+    stopListening();
+    if (!_dartApiReady) {
+      _dartApiReady = initDartApiNative(NativeApi.postCObject.cast()) == 1;
+    }
     final spaceId = _currentSpaceId!;
+    // Events are pushed by the bridge dispatcher onto this port in order.
+    final port = ReceivePort();
+    port.listen((message) {
+      if (message is String) _handleOperationJson(message);
+    });
+    _eventPort = port;
     final spaceIdPtr = spaceId.toNativeUtf8();
-    startListeningNative(spaceIdPtr);
+    try {
+      _subscriptionId = setOperationPortNative(_handle, spaceIdPtr, port.sendPort.nativePort);
+      startListeningNative(_handle, spaceIdPtr);
+    } finally {
+      malloc.free(spaceIdPtr);
+    }
+  }
+
+  void stopListening() {
+    if (_subscriptionId != 0) {
+      unregisterOperationListenerNative(_handle, _subscriptionId);
+      _subscriptionId = 0;
+    }
+    _eventPort?.close();
+    _eventPort = null;
+  }
+
+  /// Reads the space operation log after [sinceCursor] (empty = full history)
+  /// and replays it through the current event handler. Returns the new cursor.
+  /// Entries the bridge could not read yet are logged; they are part of a
+  /// later full replay once they can be read.
+  Future<String?> replayOperations({String sinceCursor = ''}) async {
+    if (!_initialized || _currentSpaceId == null) return null;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final cursorPtr = sinceCursor.toNativeUtf8();
+    final ptr = readOperationsNative(_handle, spaceIdPtr, cursorPtr);
     malloc.free(spaceIdPtr);
-    _pollTimer = Timer.periodic(const Duration(milliseconds: 200), (_) {
-      final sidPtr = spaceId.toNativeUtf8();
-      final msgPtr = pollOperationNative(sidPtr);
-      malloc.free(sidPtr);
-      if (msgPtr == nullptr) return;
-      try {
-        final jsonString = msgPtr.toDartString();
-        _handleOperationJson(jsonString);
-      } finally {
-        freeStringNative(msgPtr);
+    malloc.free(cursorPtr);
+    if (ptr == nullptr) return null;
+    try {
+      final jsonStr = ptr.toDartString();
+      if (jsonStr.isEmpty) return null;
+      final page = json.decode(jsonStr) as Map<String, dynamic>;
+      for (final entry in (page['operations'] as List<dynamic>? ?? const [])) {
+        final op = (entry as Map<String, dynamic>)['op'];
+        _handleOperationJson(jsonEncode(op));
       }
-    });
+      final skipped = page['skipped'] as List<dynamic>? ?? const [];
+      if (skipped.isNotEmpty) {
+        print('replayOperations: ${skipped.length} entries not readable yet');
+      }
+      return page['cursor'] as String?;
+    } catch (_) {
+      return null;
+    } finally {
+      freeStringNative(ptr);
+    }
+  }
+
+  /// Board materialized by the bridge rules engine from the operation log:
+  /// sessionId, board, symbols, players, turn, winner, draw, moves, rejected.
+  Future<Map<String, dynamic>?> getBoardState() async {
+    if (!_initialized || _currentSpaceId == null) return null;
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final ptr = getBoardStateNative(_handle, spaceIdPtr);
+    malloc.free(spaceIdPtr);
+    if (ptr == nullptr) return null;
+    try {
+      final jsonStr = ptr.toDartString();
+      if (jsonStr.isEmpty) return null;
+      return json.decode(jsonStr) as Map<String, dynamic>;
+    } catch (_) {
+      return null;
+    } finally {
+      freeStringNative(ptr);
+    }
+  }
+
+  /// Moves and resets of one game session read from its object tree, in
+  /// causal order: changeId, identity, timestamp (seconds), op.
+  Future<List<Map<String, dynamic>>> getSessionHistory(int sessionId) async {
+    if (!_initialized || _currentSpaceId == null) return const [];
+    final spaceIdPtr = _currentSpaceId!.toNativeUtf8();
+    final raw = _takeString(getSessionHistoryNative(_handle, spaceIdPtr, sessionId));
+    malloc.free(spaceIdPtr);
+    if (raw == null) return const [];
+    try {
+      return (json.decode(raw) as List<dynamic>).cast<Map<String, dynamic>>();
+    } catch (_) {
+      return const [];
+    }
+  }
+
+  /// Spaces stored on this device, most recently modified first, for a
+  /// "recent games" screen; works offline and before [initialize]. Each has
+  /// spaceId, spaceType, metadata (base64 of the raw bytes, null if none),
+  /// createdMs, modifiedMs, sizeBytes, member, permissions, open and, if its
+  /// store could not be read, error.
+  Future<List<Map<String, dynamic>>> listLocalSpaces() async {
+    final raw = _takeString(listLocalSpacesNative(_handle));
+    if (raw == null) return const [];
+    try {
+      return (json.decode(raw) as List<dynamic>).cast<Map<String, dynamic>>();
+    } catch (_) {
+      return const [];
+    }
+  }
+
+  /// Spaces currently open in the bridge (each with its own listener).
+  Future<List<Map<String, dynamic>>> listOpenSpaces() async {
+    final raw = _takeString(listOpenSpacesNative(_handle));
+    if (raw == null) return const [];
+    try {
+      return (json.decode(raw) as List<dynamic>).cast<Map<String, dynamic>>();
+    } catch (_) {
+      return const [];
+    }
+  }
+
+  Future<bool> closeSpace(String spaceId) async {
+    if (!_initialized) return false;
+    if (spaceId == _currentSpaceId) {
+      stopListening();
+      _currentSpaceId = null;
+    }
+    final spaceIdPtr = spaceId.toNativeUtf8();
+    try {
+      return closeSpaceNative(_handle, spaceIdPtr) == 1;
+    } finally {
+      malloc.free(spaceIdPtr);
+    }
+  }
+
+  /// Closes the space and removes its local data from this device. Returns
+  /// false, keeping the space, when a member's removal request fails.
+  Future<bool> leaveSpace(String spaceId) async {
+    final spaceIdPtr = spaceId.toNativeUtf8();
+    try {
+      if (leaveSpaceNative(_handle, spaceIdPtr) != 1) return false;
+    } finally {
+      malloc.free(spaceIdPtr);
+    }
+    if (spaceId == _currentSpaceId) {
+      stopListening();
+      _currentSpaceId = null;
+    }
+    return true;
+  }
+
+  /// Deletes a space you own from the network and this device. Peers see a
+  /// `space_deleted` op and should [leaveSpace].
+  Future<bool> deleteSpace(String spaceId) async {
+    if (!_initialized) return false;
+    final spaceIdPtr = spaceId.toNativeUtf8();
+    try {
+      final ok = deleteSpaceNative(_handle, spaceIdPtr) == 1;
+      if (ok && spaceId == _currentSpaceId) {
+        stopListening();
+        _currentSpaceId = null;
+      }
+      return ok;
+    } finally {
+      malloc.free(spaceIdPtr);
+    }
   }
 
   Future<AnySyncStatus> getStatus() async {
-    final ptr = getStatusNative();
+    final ptr = getStatusNative(_handle);
     if (ptr == nullptr) return AnySyncStatus.empty();
     try {
       final jsonStr = ptr.toDartString();
@@ -185,7 +653,7 @@ class AnySyncClient {
     }
   }
 
-  static void _handleOperationJson(String jsonString) {
+  void _handleOperationJson(String jsonString) {
     try {
       final operationData = jsonDecode(jsonString) as Map<String, dynamic>;
       final type = operationData['type'] as String?;
@@ -222,6 +690,25 @@ class AnySyncClient {
         }
         final sessionId = (operationData['sessionId'] as num?)?.toInt();
         event = TicTacToeEvent.snapshotState(players: players, board: board, to: to, meta: meta, sessionId: sessionId);
+      } else if (type == 'join_request') {
+        event = TicTacToeEvent.joinRequest(
+          spaceId: operationData['spaceId'] as String?,
+          identity: operationData['identity'] as String?,
+          recordId: operationData['recordId'] as String?,
+        );
+      } else if (type == 'acl_change') {
+        event = TicTacToeEvent.aclChange(
+          spaceId: operationData['spaceId'] as String?,
+          headId: operationData['headId'] as String?,
+          members: (operationData['members'] as List<dynamic>?)?.whereType<Map<String, dynamic>>().toList() ?? const [],
+        );
+      } else if (type == 'space_deleted') {
+        event = TicTacToeEvent.spaceDeleted(operationData['spaceId'] as String?);
+      } else if (type == 'events_dropped') {
+        event = TicTacToeEvent.eventsDropped(
+          operationData['spaceId'] as String?,
+          (operationData['count'] as num?)?.toInt(),
+        );
       }
       final handler = _eventHandler;
       if (handler != null && event != null) {
@@ -235,6 +722,49 @@ class AnySyncClient {
   }
 }
 
+class AnySyncError {
+  final String code;
+  final String op;
+  final String message;
+  final List<String> causes;
+  /// Failing CreateSpace stage (create, open, sign, push), if any.
+  final String? stage;
+  /// Set for recovered panics: Go stack trace and crash report file path.
+  final String? stack;
+  final String? crashReport;
+
+  AnySyncError({
+    required this.code,
+    required this.op,
+    required this.message,
+    required this.causes,
+    this.stage,
+    this.stack,
+    this.crashReport,
+  });
+
+  static AnySyncError? _parse(String? raw) {
+    if (raw == null) return null;
+    try {
+      final j = json.decode(raw) as Map<String, dynamic>;
+      return AnySyncError(
+        code: j['code'] as String? ?? 'internal',
+        op: j['op'] as String? ?? '',
+        message: j['message'] as String? ?? '',
+        causes: (j['causes'] as List<dynamic>?)?.cast<String>() ?? const [],
+        stage: j['stage'] as String?,
+        stack: j['stack'] as String?,
+        crashReport: j['crashReport'] as String?,
+      );
+    } catch (_) {
+      return null;
+    }
+  }
+
+  @override
+  String toString() => '$op: [$code] $message';
+}
+
 class AnySyncStatus {
   final String? spaceId;
   final int peerCount;
@@ -243,6 +773,9 @@ class AnySyncStatus {
   final int? nodePort;
   final String? networkId;
   final bool connected;
+  /// Per open space info from the bridge, including `treeSync` progress
+  /// ({missing, fetched, existing, reconciled, failed, inFlight, lastSyncMs}).
+  final List<Map<String, dynamic>> spaces;
 
   AnySyncStatus({
     this.spaceId,
@@ -252,6 +785,7 @@ class AnySyncStatus {
     this.nodePort,
     this.networkId,
     required this.connected,
+    this.spaces = const [],
   });
 
   factory AnySyncStatus.empty() => AnySyncStatus(
@@ -272,6 +806,7 @@ class AnySyncStatus {
         nodePort: (j['nodePort'] as num?)?.toInt(),
         networkId: j['networkId'] as String?,
         connected: j['connected'] == true,
+        spaces: (j['spaces'] as List?)?.whereType<Map<String, dynamic>>().toList() ?? const [],
       );
 }
 
@@ -311,7 +846,10 @@ class TicTacToeMove {
 }
 
 class TicTacToeEvent {
-  final String type; // 'tictactoe_move' or 'tictactoe_reset'
+  /// tictactoe_move, tictactoe_reset, player_register, snapshot_request,
+  /// snapshot_state, join_request, acl_change, space_deleted or
+  /// events_dropped
+  final String type;
   final TicTacToeMove? move;
   final String? by;
   final String? playerId;
@@ -323,8 +861,19 @@ class TicTacToeEvent {
   final String? emoji;
   final Map<String, Map<String, String>>? meta;
   final int? sessionId;
+  // join_request, acl_change, space_deleted and events_dropped
+  final String? spaceId;
+  /// Requesting account of a join_request; pass it to approveJoin/declineJoin.
+  final String? identity;
+  final String? recordId;
+  final String? headId;
+  /// ACL members after an acl_change, as in [AnySyncClient.listMembers].
+  final List<Map<String, dynamic>>? members;
+  /// Events of the space lost while nobody listened (events_dropped); replay
+  /// the log with replayOperations to catch up.
+  final int? count;
 
-  TicTacToeEvent._(this.type, {this.move, this.by, this.playerId, this.requesterId, this.players, this.board, this.to, this.name, this.emoji, this.meta, this.sessionId});
+  TicTacToeEvent._(this.type, {this.move, this.by, this.playerId, this.requesterId, this.players, this.board, this.to, this.name, this.emoji, this.meta, this.sessionId, this.spaceId, this.identity, this.recordId, this.headId, this.members, this.count});
 
   factory TicTacToeEvent.move(TicTacToeMove m) =>
       TicTacToeEvent._('tictactoe_move', move: m);
@@ -336,4 +885,12 @@ class TicTacToeEvent {
       TicTacToeEvent._('snapshot_request', requesterId: requesterId);
   factory TicTacToeEvent.snapshotState({List<String>? players, List<String>? board, String? to, Map<String, Map<String, String>>? meta, int? sessionId}) =>
       TicTacToeEvent._('snapshot_state', players: players, board: board, to: to, meta: meta, sessionId: sessionId);
+  factory TicTacToeEvent.joinRequest({String? spaceId, String? identity, String? recordId}) =>
+      TicTacToeEvent._('join_request', spaceId: spaceId, identity: identity, recordId: recordId);
+  factory TicTacToeEvent.aclChange({String? spaceId, String? headId, List<Map<String, dynamic>>? members}) =>
+      TicTacToeEvent._('acl_change', spaceId: spaceId, headId: headId, members: members);
+  factory TicTacToeEvent.spaceDeleted(String? spaceId) =>
+      TicTacToeEvent._('space_deleted', spaceId: spaceId);
+  factory TicTacToeEvent.eventsDropped(String? spaceId, int? count) =>
+      TicTacToeEvent._('events_dropped', spaceId: spaceId, count: count);
 }
@@ -98,44 +98,128 @@ DynamicLibrary _openDynamicLibrary() {
 
 final DynamicLibrary _lib = _openDynamicLibrary();
 
-// C signatures
-typedef InitializeClientC = Int32 Function(Pointer<Utf8>, Int32, Pointer<Utf8>);
-typedef CreateSpaceC = Pointer<Utf8> Function();
-typedef JoinSpaceC = Int32 Function(Pointer<Utf8>);
-typedef SendOperationC = Int32 Function(Pointer<Utf8>, Pointer<Utf8>);
-typedef SetOperationCallbackC = Void Function(
+// C signatures. Every export except NewClient, InitDartApi and FreeString
+// takes the client handle returned by BridgeNewClient as its first argument.
+typedef NewClientC = Int64 Function(Pointer<Utf8>);
+typedef FreeClientC = Int32 Function(Int64);
+typedef LastErrorC = Pointer<Utf8> Function(Int64);
+typedef InitializeClientC = Int32 Function(Int64, Pointer<Utf8>, Int32, Pointer<Utf8>);
+typedef InitializeFromClientConfigC = Int32 Function(Int64, Pointer<Utf8>);
+typedef CreateSpaceC = Pointer<Utf8> Function(Int64);
+typedef JoinSpaceC = Int32 Function(Int64, Pointer<Utf8>);
+typedef CreateInviteC = Pointer<Utf8> Function(Int64, Pointer<Utf8>);
+typedef JoinWithInviteC = Int32 Function(Int64, Pointer<Utf8>);
+typedef ApproveJoinC = Int32 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>);
+typedef DeclineJoinC = Int32 Function(Int64, Pointer<Utf8>, Pointer<Utf8>);
+typedef SendOperationC = Int32 Function(Int64, Pointer<Utf8>, Pointer<Utf8>);
+typedef SetOperationCallbackC = Int64 Function(
+  Int64,
   Pointer<Utf8>,
   Pointer<NativeFunction<Void Function(Pointer<Utf8>)>>,
 );
-typedef StartListeningC = Int32 Function(Pointer<Utf8>);
+typedef StartListeningC = Int32 Function(Int64, Pointer<Utf8>);
 typedef FreeStringC = Void Function(Pointer<Utf8>);
-typedef GetStatusC = Pointer<Utf8> Function();
-typedef PollOperationC = Pointer<Utf8> Function(Pointer<Utf8>);
+typedef GetStatusC = Pointer<Utf8> Function(Int64);
+typedef PollOperationC = Pointer<Utf8> Function(Int64, Pointer<Utf8>);
+typedef ReadOperationsC = Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>);
+typedef InitDartApiC = Int32 Function(Pointer<Void>);
+typedef GetBoardStateC = Pointer<Utf8> Function(Int64, Pointer<Utf8>);
+typedef GetSessionHistoryC = Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int64);
+typedef CreateAccountC = Pointer<Utf8> Function(Int64, Pointer<Utf8>);
+typedef ListOpenSpacesC = Pointer<Utf8> Function(Int64);
+typedef ShutdownC = Int32 Function(Int64);
+typedef CloseSpaceC = Int32 Function(Int64, Pointer<Utf8>);
+typedef ImportMnemonicC = Int32 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>, Int32);
+typedef ExportMnemonicC = Pointer<Utf8> Function(Int64, Pointer<Utf8>);
+typedef UnlockAccountC = Int32 Function(Int64, Pointer<Utf8>);
+typedef SetOperationPortC = Int64 Function(Int64, Pointer<Utf8>, Int64);
+typedef UnregisterOperationListenerC = Int32 Function(Int64, Int64);
 
 // Dart typedefs
-typedef InitializeClientDart = int Function(Pointer<Utf8>, int, Pointer<Utf8>);
-typedef CreateSpaceDart = Pointer<Utf8> Function();
-typedef JoinSpaceDart = int Function(Pointer<Utf8>);
-typedef SendOperationDart = int Function(Pointer<Utf8>, Pointer<Utf8>);
-typedef SetOperationCallbackDart = void Function(
+typedef NewClientDart = int Function(Pointer<Utf8>);
+typedef FreeClientDart = int Function(int);
+typedef LastErrorDart = Pointer<Utf8> Function(int);
+typedef InitializeClientDart = int Function(int, Pointer<Utf8>, int, Pointer<Utf8>);
+typedef InitializeFromClientConfigDart = int Function(int, Pointer<Utf8>);
+typedef CreateSpaceDart = Pointer<Utf8> Function(int);
+typedef JoinSpaceDart = int Function(int, Pointer<Utf8>);
+typedef CreateInviteDart = Pointer<Utf8> Function(int, Pointer<Utf8>);
+typedef JoinWithInviteDart = int Function(int, Pointer<Utf8>);
+typedef ApproveJoinDart = int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>);
+typedef DeclineJoinDart = int Function(int, Pointer<Utf8>, Pointer<Utf8>);
+typedef SendOperationDart = int Function(int, Pointer<Utf8>, Pointer<Utf8>);
+typedef SetOperationCallbackDart = int Function(
+  int,
   Pointer<Utf8>,
   Pointer<NativeFunction<Void Function(Pointer<Utf8>)>>,
 );
-typedef StartListeningDart = int Function(Pointer<Utf8>);
+typedef StartListeningDart = int Function(int, Pointer<Utf8>);
 typedef FreeStringDart = void Function(Pointer<Utf8>);
-typedef GetStatusDart = Pointer<Utf8> Function();
-typedef PollOperationDart = Pointer<Utf8> Function(Pointer<Utf8>);
+typedef GetStatusDart = Pointer<Utf8> Function(int);
+typedef PollOperationDart = Pointer<Utf8> Function(int, Pointer<Utf8>);
+typedef ReadOperationsDart = Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>);
+typedef InitDartApiDart = int Function(Pointer<Void>);
+typedef GetBoardStateDart = Pointer<Utf8> Function(int, Pointer<Utf8>);
+typedef GetSessionHistoryDart = Pointer<Utf8> Function(int, Pointer<Utf8>, int);
+typedef CreateAccountDart = Pointer<Utf8> Function(int, Pointer<Utf8>);
+typedef ListOpenSpacesDart = Pointer<Utf8> Function(int);
+typedef ShutdownDart = int Function(int);
+typedef CloseSpaceDart = int Function(int, Pointer<Utf8>);
+typedef ImportMnemonicDart = int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>, int);
+typedef ExportMnemonicDart = Pointer<Utf8> Function(int, Pointer<Utf8>);
+typedef UnlockAccountDart = int Function(int, Pointer<Utf8>);
+typedef SetOperationPortDart = int Function(int, Pointer<Utf8>, int);
+typedef UnregisterOperationListenerDart = int Function(int, int);
 
 // Lookup bindings (suffixed with Native to avoid name collisions)
+final NewClientDart newClientNative =
+    _lib.lookup<NativeFunction<NewClientC>>('BridgeNewClient').asFunction();
+
+final FreeClientDart freeClientNative =
+    _lib.lookup<NativeFunction<FreeClientC>>('BridgeFreeClient').asFunction();
+
+final LastErrorDart lastErrorNative =
+    _lib.lookup<NativeFunction<LastErrorC>>('BridgeLastError').asFunction();
+
 final InitializeClientDart initializeClientNative =
     _lib.lookup<NativeFunction<InitializeClientC>>('BridgeInitializeClient').asFunction();
 
+final InitializeFromClientConfigDart initializeFromClientConfigNative =
+    _lib.lookup<NativeFunction<InitializeFromClientConfigC>>('BridgeInitializeFromClientConfig').asFunction();
+
 final CreateSpaceDart createSpaceNative =
     _lib.lookup<NativeFunction<CreateSpaceC>>('BridgeCreateSpace').asFunction();
 
+final CreateSpaceDart createSpaceWithReportNative =
+    _lib.lookup<NativeFunction<CreateSpaceC>>('BridgeCreateSpaceWithReport').asFunction();
+
 final JoinSpaceDart joinSpaceNative =
     _lib.lookup<NativeFunction<JoinSpaceC>>('BridgeJoinSpace').asFunction();
 
+final CreateInviteDart createInviteNative =
+    _lib.lookup<NativeFunction<CreateInviteC>>('BridgeCreateInvite').asFunction();
+
+final JoinWithInviteDart joinWithInviteNative =
+    _lib.lookup<NativeFunction<JoinWithInviteC>>('BridgeJoinWithInvite').asFunction();
+
+final JoinSpaceDart requestJoinNative =
+    _lib.lookup<NativeFunction<JoinSpaceC>>('BridgeRequestJoin').asFunction();
+
+final ApproveJoinDart approveJoinNative =
+    _lib.lookup<NativeFunction<ApproveJoinC>>('BridgeApproveJoin').asFunction();
+
+final DeclineJoinDart declineJoinNative =
+    _lib.lookup<NativeFunction<DeclineJoinC>>('BridgeDeclineJoin').asFunction();
+
+final GetBoardStateDart listMembersNative =
+    _lib.lookup<NativeFunction<GetBoardStateC>>('BridgeListMembers').asFunction();
+
+final ApproveJoinDart setPermissionsNative =
+    _lib.lookup<NativeFunction<ApproveJoinC>>('BridgeSetPermissions').asFunction();
+
+final DeclineJoinDart removeMemberNative =
+    _lib.lookup<NativeFunction<DeclineJoinC>>('BridgeRemoveMember').asFunction();
+
 final SendOperationDart sendOperationNative =
     _lib.lookup<NativeFunction<SendOperationC>>('BridgeSendOperation').asFunction();
 
@@ -154,3 +238,64 @@ final PollOperationDart pollOperationNative =
 
 final GetStatusDart getStatusNative =
     _lib.lookup<NativeFunction<GetStatusC>>('BridgeGetStatus').asFunction();
+
+final ReadOperationsDart readOperationsNative =
+    _lib.lookup<NativeFunction<ReadOperationsC>>('BridgeReadOperations').asFunction();
+
+final InitDartApiDart initDartApiNative =
+    _lib.lookup<NativeFunction<InitDartApiC>>('BridgeInitDartApi').asFunction();
+
+final SetOperationPortDart setOperationPortNative =
+    _lib.lookup<NativeFunction<SetOperationPortC>>('BridgeSetOperationPort').asFunction();
+
+final UnregisterOperationListenerDart unregisterOperationListenerNative = _lib
+    .lookup<NativeFunction<UnregisterOperationListenerC>>('BridgeUnregisterOperationListener')
+    .asFunction();
+
+final GetBoardStateDart getBoardStateNative =
+    _lib.lookup<NativeFunction<GetBoardStateC>>('BridgeGetBoardState').asFunction();
+
+final GetSessionHistoryDart getSessionHistoryNative =
+    _lib.lookup<NativeFunction<GetSessionHistoryC>>('BridgeGetSessionHistory').asFunction();
+
+final CreateAccountDart createAccountNative =
+    _lib.lookup<NativeFunction<CreateAccountC>>('BridgeCreateAccount').asFunction();
+
+final ImportMnemonicDart importMnemonicNative =
+    _lib.lookup<NativeFunction<ImportMnemonicC>>('BridgeImportMnemonic').asFunction();
+
+final ExportMnemonicDart exportMnemonicNative =
+    _lib.lookup<NativeFunction<ExportMnemonicC>>('BridgeExportMnemonic').asFunction();
+
+final UnlockAccountDart unlockAccountNative =
+    _lib.lookup<NativeFunction<UnlockAccountC>>('BridgeUnlockAccount').asFunction();
+
+final ListOpenSpacesDart listOpenSpacesNative =
+    _lib.lookup<NativeFunction<ListOpenSpacesC>>('BridgeListOpenSpaces').asFunction();
+
+final ListOpenSpacesDart listLocalSpacesNative =
+    _lib.lookup<NativeFunction<ListOpenSpacesC>>('BridgeListLocalSpaces').asFunction();
+
+final CloseSpaceDart closeSpaceNative =
+    _lib.lookup<NativeFunction<CloseSpaceC>>('BridgeCloseSpace').asFunction();
+
+final CloseSpaceDart leaveSpaceNative =
+    _lib.lookup<NativeFunction<CloseSpaceC>>('BridgeLeaveSpace').asFunction();
+
+final CloseSpaceDart deleteSpaceNative =
+    _lib.lookup<NativeFunction<CloseSpaceC>>('BridgeDeleteSpace').asFunction();
+
+final ShutdownDart shutdownNative =
+    _lib.lookup<NativeFunction<ShutdownC>>('BridgeShutdown').asFunction();
+
+final GetStatusDart checkLayoutNative =
+    _lib.lookup<NativeFunction<GetStatusC>>('BridgeCheckLayout').asFunction();
+
+final GetStatusDart migrateLayoutNative =
+    _lib.lookup<NativeFunction<GetStatusC>>('BridgeMigrateLayout').asFunction();
+
+final ShutdownDart wipeLocalDataNative =
+    _lib.lookup<NativeFunction<ShutdownC>>('BridgeWipeLocalData').asFunction();
+
+final InitializeClientDart reconfigureNative =
+    _lib.lookup<NativeFunction<InitializeClientC>>('BridgeReconfigure').asFunction();
@@ -44,6 +44,8 @@ class _GameScreenState extends State<GameScreen> {
   bool _verboseLog = false;
   bool _nodeReachable = false;
   String? _nodeReachError;
+  // unlocks the keystore; asked once per app run
+  String? _passphrase;
 
   @override
   void initState() {
@@ -53,15 +55,27 @@ class _GameScreenState extends State<GameScreen> {
 
   Future<void> _initializeGame() async {
     try {
+      final passphrase = _passphrase ?? await _askPassphrase();
+      if (passphrase == null) {
+        setState(() => _error = 'A passphrase is needed to unlock the account');
+        return;
+      }
+      String? mnemonic;
       final success = await _client.initialize(
         nodeHost: _host,
         nodePort: _port,
         networkId: _networkId,
+        passphrase: passphrase,
+        onAccountCreated: (m) => mnemonic = m,
       );
       if (!success) {
-        setState(() => _error = 'Failed to connect to any-sync network');
+        final err = _client.lastError();
+        if (err?.code == 'bad_passphrase') _passphrase = null;
+        setState(() => _error = 'Failed to connect to any-sync network: ${err?.message ?? 'unknown error'}');
         return;
       }
+      _passphrase = passphrase;
+      if (mnemonic != null) await _showMnemonic(mnemonic!);
       final spaceId = await _client.createTicTacToeSpace();
       if (spaceId == null) {
         setState(() => _error = 'Failed to create game space');
@@ -74,30 +88,8 @@ class _GameScreenState extends State<GameScreen> {
       });
       await _announcePresenceAndMaybeRequestSnapshot();
       _startStatusPolling();
-      _client.startListening((event) {
-        if (event.type == 'tictactoe_reset') {
-          _game.reset();
-        } else if (event.type == 'tictactoe_move' && event.move != null) {
-          _game.handleRemoteMove(event.move!);
-        } else if (event.type == 'player_register' && event.playerId != null) {
-          _game.registerPlayer(event.playerId!, name: event.name, emoji: event.emoji);
-          _maybeNotifyJoin(event.playerId!);
-        } else if (event.type == 'snapshot_request' && event.requesterId != null) {
-          if (_iAmCreator) {
-            _client.sendSnapshotState(
-              players: _game.playersOrdered,
-              board: _game.board,
-              to: event.requesterId!,
-              meta: _game.playersMeta,
-            );
-          }
-        } else if (event.type == 'snapshot_state' && event.to == _game.localPlayerId) {
-          if (event.players != null && event.board != null && event.board!.length == 9) {
-            _game.applySnapshot(players: event.players!, board: event.board!, meta: event.meta ?? {});
-          }
-        }
-        setState(() {});
-      });
+      _client.startListening(_onEvent);
+      await _refreshBoard();
     } catch (e) {
       setState(() => _error = 'Error: $e');
     }
@@ -111,20 +103,111 @@ class _GameScreenState extends State<GameScreen> {
       return;
     }
     if (_game.canPlayPosition(position)) {
-      final move = _game.createLocalMove(position);
-      _game.applyMove(move);
-      _client.sendMove(move);
-      setState(() {});
+      _sendMove(_game.createLocalMove(position));
     }
   }
 
+  Future<void> _sendMove(TicTacToeMove move) async {
+    // The bridge validates the move against its log; the board is only
+    // redrawn from the engine, never from the local guess.
+    final ok = await _client.sendMove(move);
+    if (!ok && mounted) {
+      final err = _client.lastError();
+      ScaffoldMessenger.of(context).showSnackBar(
+        SnackBar(content: Text('Move rejected: ${err?.message ?? 'unknown error'}')),
+      );
+    }
+    await _refreshBoard();
+  }
+
   void _restartGame() {
     final newId = _game.newSession();
     // Broadcast reset so peers clear their boards and align session
-    _client.sendReset(by: _game.localPlayerId, sessionId: newId);
+    _client.sendReset(by: _game.localPlayerId, sessionId: newId).then((_) => _refreshBoard());
+    setState(() {});
+  }
+
+  /// Redraws the board from the bridge rules engine (BridgeGetBoardState).
+  Future<void> _refreshBoard() async {
+    final state = await _client.getBoardState();
+    if (state == null || !mounted) return;
+    setState(() => _game.applyBoardState(state));
+  }
+
+  void _onEvent(TicTacToeEvent event) {
+    if (event.type == 'tictactoe_reset' || event.type == 'tictactoe_move') {
+      _refreshBoard();
+    } else if (event.type == 'player_register' && event.playerId != null) {
+      _game.registerPlayer(event.playerId!, name: event.name, emoji: event.emoji);
+      _maybeNotifyJoin(event.playerId!);
+    } else if (event.type == 'snapshot_request' && event.requesterId != null) {
+      if (_iAmCreator) {
+        _client.sendSnapshotState(
+          players: _game.playersOrdered,
+          board: _game.board,
+          to: event.requesterId!,
+          meta: _game.playersMeta,
+        );
+      }
+    } else if (event.type == 'snapshot_state' && event.to == _game.localPlayerId) {
+      if (event.players != null) {
+        _game.applySnapshot(players: event.players!, meta: event.meta ?? {});
+      }
+      _refreshBoard();
+    } else if (event.type == 'join_request' && event.identity != null) {
+      _showJoinRequest(event.identity!);
+    } else if (event.type == 'acl_change') {
+      final n = event.members?.length ?? 0;
+      ScaffoldMessenger.of(context).showSnackBar(
+        SnackBar(content: Text('Space members changed ($n member${n == 1 ? '' : 's'})')),
+      );
+    } else if (event.type == 'space_deleted' && event.spaceId == _spaceId) {
+      _onSpaceDeleted(event.spaceId!);
+    }
     setState(() {});
   }
 
+  Future<void> _showJoinRequest(String identity) async {
+    final short = identity.length > 12 ? '${identity.substring(0, 12)}…' : identity;
+    final approve = await showDialog<bool>(
+      context: context,
+      builder: (context) => AlertDialog(
+        title: const Text('Join Request'),
+        content: Text('$short wants to join this game.'),
+        actions: [
+          TextButton(
+            onPressed: () => Navigator.pop(context, false),
+            child: const Text('Decline'),
+          ),
+          ElevatedButton(
+            onPressed: () => Navigator.pop(context, true),
+            child: const Text('Approve'),
+          )
+        ],
+      ),
+    );
+    if (approve == null) return;
+    final ok = approve ? await _client.approveJoin(identity) : await _client.declineJoin(identity);
+    if (!ok && mounted) {
+      ScaffoldMessenger.of(context).showSnackBar(
+        SnackBar(content: Text('Join request: ${_client.lastError()?.message ?? 'failed'}')),
+      );
+    }
+  }
+
+  Future<void> _onSpaceDeleted(String spaceId) async {
+    // the owner deleted the space from the network; drop the local copy too
+    await _client.leaveSpace(spaceId);
+    if (!mounted) return;
+    setState(() {
+      _spaceId = null;
+      _game.reset();
+    });
+    ScaffoldMessenger.of(context).showSnackBar(
+      const SnackBar(content: Text('The game space was deleted by its owner')),
+    );
+  }
+
   void _startStatusPolling() {
     _statusTimer?.cancel();
     _statusTimer = Timer.periodic(const Duration(seconds: 1), (_) async {
@@ -147,6 +230,8 @@ class _GameScreenState extends State<GameScreen> {
         _nodeReachable = reachable;
         _nodeReachError = reachError;
       });
+      // session tree changes can land after the op log event that announced them
+      await _refreshBoard();
       if (_verboseLog) {
         // ignore: avoid_print
         print('Status: peers=${s.peerCount}, lastSyncMs=${s.lastSyncMs}, node=${s.nodeHost}:${s.nodePort}, space=${s.spaceId}');
@@ -297,7 +382,7 @@ class _GameScreenState extends State<GameScreen> {
                         if (!_game.isOver)
                           Text(
                             _game.isMyTurn()
-                                ? 'Your turn (${_game._getPlayerSymbol(_game.localPlayerId)})'
+                                ? 'Your turn (${_game.localSymbol})'
                                 : 'Waiting: ${_game.playerEmoji(_game.currentTurnPlayerId ?? '')} ${_game.playerName(_game.currentTurnPlayerId ?? '')}',
                             style: TextStyle(
                               fontWeight: FontWeight.bold,
@@ -383,30 +468,8 @@ class _GameScreenState extends State<GameScreen> {
                 if (ok) {
                   setState(() => _spaceId = id);
                   _iAmCreator = false;
-                  _client.startListening((event) {
-                    if (event.type == 'tictactoe_reset') {
-                      _game.reset();
-                    } else if (event.type == 'tictactoe_move' && event.move != null) {
-                      _game.handleRemoteMove(event.move!);
-                    } else if (event.type == 'player_register' && event.playerId != null) {
-                      _game.registerPlayer(event.playerId!, name: event.name, emoji: event.emoji);
-                      _maybeNotifyJoin(event.playerId!);
-                    } else if (event.type == 'snapshot_request' && event.requesterId != null) {
-                      if (_iAmCreator) {
-                        _client.sendSnapshotState(
-                          players: _game.playersOrdered,
-                          board: _game.board,
-                          to: event.requesterId!,
-                          meta: _game.playersMeta,
-                        );
-                      }
-                    } else if (event.type == 'snapshot_state' && event.to == _game.localPlayerId) {
-                      if (event.players != null && event.board != null && event.board!.length == 9) {
-                        _game.applySnapshot(players: event.players!, board: event.board!, meta: event.meta ?? {});
-                      }
-                    }
-                    setState(() {});
-                  });
+                  _client.startListening(_onEvent);
+                  await _refreshBoard();
                   // Announce presence and request snapshot from creator/peers
                   await _announcePresenceAndMaybeRequestSnapshot();
                   _startStatusPolling();
@@ -496,6 +559,53 @@ class _GameScreenState extends State<GameScreen> {
 }
 
 extension on _GameScreenState {
+  Future<String?> _askPassphrase() async {
+    // wait for the first frame so the dialog has a context to attach to
+    await WidgetsBinding.instance.endOfFrame;
+    if (!mounted) return null;
+    final controller = TextEditingController();
+    final value = await showDialog<String>(
+      context: context,
+      barrierDismissible: false,
+      builder: (context) => AlertDialog(
+        title: const Text('Account Passphrase'),
+        content: TextField(
+          controller: controller,
+          obscureText: true,
+          autofocus: true,
+          decoration: const InputDecoration(hintText: 'Unlocks (or creates) this device account'),
+        ),
+        actions: [
+          ElevatedButton(
+            onPressed: () {
+              if (controller.text.isNotEmpty) Navigator.pop(context, controller.text);
+            },
+            child: const Text('Unlock'),
+          )
+        ],
+      ),
+    );
+    return value == null || value.isEmpty ? null : value;
+  }
+
+  Future<void> _showMnemonic(String mnemonic) async {
+    if (!mounted) return;
+    await showDialog<void>(
+      context: context,
+      barrierDismissible: false,
+      builder: (context) => AlertDialog(
+        title: const Text('Recovery Phrase'),
+        content: SelectableText('Write these words down. They are the only way to restore this account:\n\n$mnemonic'),
+        actions: [
+          ElevatedButton(
+            onPressed: () => Navigator.pop(context),
+            child: const Text('Done'),
+          )
+        ],
+      ),
+    );
+  }
+
   Future<void> _announcePresenceAndMaybeRequestSnapshot() async {
     // Announce this player
     await _client.sendPlayerRegister(
@@ -529,9 +639,12 @@ const _emojis = [
   '😀','😄','😁','😎','🤩','😊','😉','🥳','🤠','🧠','🦊','🐱','🐶','🐼','🐯','🐵','🐸','🐤','🦄','🐙','🐳','🐝','🌈','⭐️','⚡️','🔥','🍀','🍉','🍕','🍩'
 ];
 
+/// Local view of the game. Board, turn and outcome are not computed here:
+/// they are copied from the bridge rules engine, which replays the space
+/// operation log in the same order on every peer (first move on a cell wins).
+/// Only player names and emojis are kept locally.
 class SimpleTicTacToeCRDT {
   List<String> board = List.filled(9, '');
-  final Map<String, TicTacToeMove> allMoves = {};
   final List<String> playersOrdered = [];
   final Map<String, String> _playerNames = {};
   final Map<String, String> _playerEmojis = {};
@@ -539,6 +652,12 @@ class SimpleTicTacToeCRDT {
   late String localName;
   late String localEmoji;
   int sessionId = 1;
+  // seated players (X then O), as decided by the engine
+  List<String> _seats = const [];
+  String _turn = '';
+  String _winner = '';
+  bool _draw = false;
+  int _moveCount = 0;
 
   SimpleTicTacToeCRDT() {
     localPlayerId = 'player_${Random().nextInt(1000)}';
@@ -551,7 +670,11 @@ class SimpleTicTacToeCRDT {
 
   void reset() {
     board = List.filled(9, '');
-    allMoves.clear();
+    _seats = const [];
+    _turn = '';
+    _winner = '';
+    _draw = false;
+    _moveCount = 0;
   }
 
   int newSession() {
@@ -568,20 +691,34 @@ class SimpleTicTacToeCRDT {
     if (emoji != null && emoji.isNotEmpty) _playerEmojis[playerId] = emoji;
   }
 
-  void applySnapshot({required List<String> players, required List<String> board, Map<String, Map<String, String>> meta = const {}}) {
-    playersOrdered
-      ..clear()
-      ..addAll(players);
-    this.board = List<String>.from(board);
+  /// Players and their names from a peer; the board always comes from
+  /// [applyBoardState].
+  void applySnapshot({required List<String> players, Map<String, Map<String, String>> meta = const {}}) {
+    for (final pid in players) {
+      registerPlayer(pid);
+    }
     for (final e in meta.entries) {
-      final pid = e.key;
-      final m = e.value;
-      registerPlayer(pid, name: m['name'], emoji: m['emoji']);
+      registerPlayer(e.key, name: e.value['name'], emoji: e.value['emoji']);
+    }
+  }
+
+  /// Copies a BoardState from the bridge (getBoardState).
+  void applyBoardState(Map<String, dynamic> state) {
+    final symbols = (state['symbols'] as List<dynamic>?)?.map((s) => (s ?? '').toString()).toList();
+    board = symbols != null && symbols.length == 9 ? symbols : List.filled(9, '');
+    sessionId = (state['sessionId'] as num?)?.toInt() ?? sessionId;
+    _seats = (state['players'] as List<dynamic>?)?.cast<String>() ?? const [];
+    _turn = state['turn'] as String? ?? '';
+    _winner = state['winner'] as String? ?? '';
+    _draw = state['draw'] == true;
+    _moveCount = (state['moves'] as List<dynamic>?)?.length ?? 0;
+    for (final pid in _seats) {
+      registerPlayer(pid);
     }
   }
 
   bool canPlayPosition(int position) {
-    return position >= 0 && position < 9 && board[position].isEmpty;
+    return position >= 0 && position < 9 && board[position].isEmpty && !isOver;
   }
 
   TicTacToeMove createLocalMove(int position) {
@@ -594,42 +731,15 @@ class SimpleTicTacToeCRDT {
     );
   }
 
-  void applyMove(TicTacToeMove move) {
-    if (move.sessionId != sessionId) {
-      return;
-    }
-    registerPlayer(move.playerId);
-    final existingMove = _findMoveAtPosition(move.position);
-    if (existingMove == null) {
-      allMoves[move.id] = move;
-      board[move.position] = _getPlayerSymbol(move.playerId);
-    } else {
-      // Conflict resolution: timestamp wins
-      if (move.timestamp > existingMove.timestamp) {
-        allMoves.remove(existingMove.id);
-        allMoves[move.id] = move;
-        board[move.position] = _getPlayerSymbol(move.playerId);
-      }
-    }
-  }
-
-  void handleRemoteMove(TicTacToeMove move) {
-    applyMove(move);
+  // Seat the engine gives localPlayerId: its index once it has moved,
+  // otherwise the next free seat; -1 when both are taken.
+  int get _localSeat {
+    final idx = _seats.indexOf(localPlayerId);
+    if (idx >= 0) return idx;
+    return _seats.length < 2 ? _seats.length : -1;
   }
 
-  TicTacToeMove? _findMoveAtPosition(int position) {
-    for (final m in allMoves.values) {
-      if (m.position == position) return m;
-    }
-    return null;
-  }
-
-  String _getPlayerSymbol(String playerId) {
-    registerPlayer(playerId);
-    final idx = playersOrdered.indexOf(playerId);
-    const symbols = ['X', 'O', '△', '□', '◇'];
-    return symbols[idx.clamp(0, symbols.length - 1)];
-  }
+  String get localSymbol => const ['X', 'O'][_localSeat.clamp(0, 1)];
 
   String playerName(String playerId) => _playerNames[playerId] ?? 'Player';
   String playerEmoji(String playerId) => _playerEmojis[playerId] ?? '🙂';
@@ -638,56 +748,26 @@ class SimpleTicTacToeCRDT {
           pid: {'name': playerName(pid), 'emoji': playerEmoji(pid)}
       };
 
-  String? get currentTurnPlayerId {
-    final count = board.where((c) => c.isNotEmpty).length;
-    if (playersOrdered.isEmpty) return null;
-    final idx = count % playersOrdered.length;
-    return playersOrdered[idx];
-  }
+  /// Player to move, or null while the next seat is still free.
+  String? get currentTurnPlayerId => _turn.isEmpty ? null : _turn;
 
-  bool isMyTurn() => currentTurnPlayerId == localPlayerId;
+  bool isMyTurn() {
+    if (isOver) return false;
+    if (_turn.isNotEmpty) return _turn == localPlayerId;
+    return _localSeat >= 0 && _localSeat == _moveCount % 2;
+  }
 
   String getStatusText() {
-    final winner = _checkWinner();
-    if (winner != null) {
-      return winner == localPlayerId ? 'You win!' : 'You lose!';
+    if (_winner.isNotEmpty) {
+      return _winner == localPlayerId ? 'You win!' : 'You lose!';
     }
-    if (board.every((c) => c.isNotEmpty)) {
+    if (_draw) {
       return "It's a draw!";
     }
     return 'Game in progress';
   }
 
-  bool get isOver {
-    if (_checkWinner() != null) return true;
-    return board.every((c) => c.isNotEmpty);
-  }
-
-  String? _checkWinner() {
-    const patterns = [
-      [0, 1, 2],
-      [3, 4, 5],
-      [6, 7, 8],
-      [0, 3, 6],
-      [1, 4, 7],
-      [2, 5, 8],
-      [0, 4, 8],
-      [2, 4, 6]
-    ];
-    for (final pattern in patterns) {
-      final a = board[pattern[0]];
-      final b = board[pattern[1]];
-      final c = board[pattern[2]];
-      if (a.isNotEmpty && a == b && b == c) {
-        for (final move in allMoves.values) {
-          if (_getPlayerSymbol(move.playerId) == a) {
-            return move.playerId;
-          }
-        }
-      }
-    }
-    return null;
-  }
+  bool get isOver => _winner.isNotEmpty || _draw;
 }
 
 // (old duplicate extension removed)
@@ -112,7 +112,7 @@ build_abi() {
       CC="$cc" \
       CGO_CFLAGS="--target=$target" \
       CGO_LDFLAGS="--target=$target" \
-      go build -buildmode=c-shared -o "$outdir/libanysync_bridge.so" anysync_bridge.go
+      go build -buildmode=c-shared -o "$outdir/libanysync_bridge.so" .
   )
 }
 
@@ -32,7 +32,7 @@ echo "Building c-archive (iphoneos, arm64)"
     CC="$(xcrun --sdk iphoneos -f clang)" \
     CGO_CFLAGS="-isysroot $SDK_PATH -miphoneos-version-min=$IOS_MIN_SDK" \
     CGO_LDFLAGS="-isysroot $SDK_PATH -miphoneos-version-min=$IOS_MIN_SDK" \
-    go build -buildmode=c-archive -o "$OUT_BASE/iphoneos/anysync_bridge.a" anysync_bridge.go
+    go build -buildmode=c-archive -o "$OUT_BASE/iphoneos/anysync_bridge.a" .
 )
 
 echo "Building c-archive (simulator, arm64)"
@@ -46,7 +46,7 @@ echo "Building c-archive (simulator, arm64)"
     CC="$(xcrun --sdk iphonesimulator -f clang)" \
     CGO_CFLAGS="-isysroot $SDK_PATH -mios-simulator-version-min=$IOS_MIN_SDK" \
     CGO_LDFLAGS="-isysroot $SDK_PATH -mios-simulator-version-min=$IOS_MIN_SDK" \
-    go build -buildmode=c-archive -o "$OUT_BASE/simulator/anysync_bridge.a" anysync_bridge.go
+    go build -buildmode=c-archive -o "$OUT_BASE/simulator/anysync_bridge.a" .
 )
 
 echo "Creating xcframework"